@@ -0,0 +1,71 @@
+// Package auth hashes passwords and API tokens of users.
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrNoPassword is returned for users without a password, who sign in
+// with tokens only.
+var ErrNoPassword = errors.New("user has no password")
+
+// HashPassword hashes the password with bcrypt.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares the password with the hash made by HashPassword.
+func CheckPassword(hash string, password string) error {
+	if hash == "" {
+		return ErrNoPassword
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+// NewToken makes a random token. Only the hash of the token is stored, the
+// token itself is shown to the user once.
+func NewToken() (string, string, error) {
+	data := make([]byte, 24)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(data)
+	return token, HashToken(token), nil
+}
+
+// HashToken hashes the token to look it up. Tokens are random, so a fast
+// hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FeverKey makes the key Fever API clients sign in with, md5 of the name
+// and the password. It is as weak as the protocol requires, so clients
+// get a password of their own made by NewFeverPassword.
+func FeverKey(name string, password string) string {
+	sum := md5.Sum([]byte(name + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewFeverPassword makes a random password Fever API clients of the user
+// sign in with. Like tokens, only the hash of its key is stored and the
+// password is shown to the user once.
+func NewFeverPassword(name string) (string, string, error) {
+	password, _, err := NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	return password, HashToken(FeverKey(name, password)), nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import "testing"
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "secret" {
+		t.Fatalf("Password is not hashed")
+	}
+	if err := CheckPassword(hash, "secret"); err != nil {
+		t.Errorf("Password does not match: %v", err)
+	}
+	if err := CheckPassword(hash, "Secret"); err == nil {
+		t.Errorf("Wrong password matches")
+	}
+	if err := CheckPassword("", ""); err != ErrNoPassword {
+		t.Errorf("Empty hash gives %v", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 48 {
+		t.Errorf("Token is %d chars", len(token))
+	}
+	if HashToken(token) != hash {
+		t.Errorf("Hash of the token differs")
+	}
+
+	other, _, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Errorf("Tokens repeat")
+	}
+}
+
+func TestFeverKey(t *testing.T) {
+	// md5 of "alice:pw"
+	want := "430a6a24c1999a7a0355012f4ae93f1a"
+	if key := FeverKey("alice", "pw"); key != want {
+		t.Errorf("FeverKey() = %s, want %s", key, want)
+	}
+}
+
+func TestNewFeverPassword(t *testing.T) {
+	password, hash, err := NewFeverPassword("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != HashToken(FeverKey("alice", password)) {
+		t.Errorf("Hash %s is not of the key of %s", hash, password)
+	}
+	other, _, err := NewFeverPassword("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == password {
+		t.Errorf("Passwords repeat")
+	}
+}
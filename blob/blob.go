@@ -0,0 +1,20 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps immutable blobs addressed by the hash of their content.
+type Store interface {
+	Put([]byte) (string, error)
+	Get(string) ([]byte, error)
+}
+
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FileStore keeps zstd compressed blobs in a local directory fanned out by
+// the first bytes of the hash: <root>/ab/cd/abcd....zst
+type FileStore struct {
+	root string
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+}
+
+func (s *FileStore) path(hash string) (string, error) {
+	if len(hash) < 4 {
+		return "", fmt.Errorf("bad blob hash %q", hash)
+	}
+	return filepath.Join(s.root, hash[0:2], hash[2:4], hash+".zst"), nil
+}
+
+func (s *FileStore) Put(data []byte) (string, error) {
+	hash := Hash(data)
+	p, err := s.path(hash)
+	if err != nil {
+		return "", err
+	}
+
+	// Content addressed blobs never change, so an existing file is the same blob.
+	_, err = os.Stat(p)
+	if err == nil {
+		return hash, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), hash+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(s.enc.EncodeAll(data, nil))
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *FileStore) Get(hash string) ([]byte, error) {
+	p, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return s.dec.DecodeAll(data, nil)
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	store := FileStore{
+		root: root,
+		enc:  enc,
+		dec:  dec,
+	}
+	return &store, nil
+}
@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("<p>hello</p>"), 100)
+	hash, err := s.Put(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != Hash(data) {
+		t.Errorf("Put returned %s instead of content hash", hash)
+	}
+
+	again, err := s.Put(data)
+	if err != nil || again != hash {
+		t.Errorf("Put of the same blob gives %s, %v", again, err)
+	}
+
+	got, err := s.Get(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get returned different content")
+	}
+
+	p := filepath.Join(s.root, hash[0:2], hash[2:4], hash+".zst")
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= int64(len(data)) {
+		t.Errorf("Blob is not compressed: %d bytes", info.Size())
+	}
+}
+
+func TestFileStoreNotFound(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Get(Hash([]byte("missing")))
+	if err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
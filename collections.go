@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+func addSavedSearch(db store.Store, slug string, query string, title string, feedSlugs []string, since time.Time, until time.Time, within time.Duration) error {
+	_, err := db.GetFeedBySlug(slug)
+	if err == nil {
+		return fmt.Errorf("feed %s already exists", slug)
+	}
+
+	// Check the query before saving it.
+	_, err = db.Search(query, internal.SearchFilter{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("bad query: %w", err)
+	}
+
+	saved := internal.SavedSearch{
+		Slug:     slug,
+		Title:    title,
+		Query:    query,
+		FeedIDs:  make([]string, 0, len(feedSlugs)),
+		Since:    since,
+		Until:    until,
+		WithinMs: within.Milliseconds(),
+	}
+	for _, s := range feedSlugs {
+		feed, err := db.GetFeedBySlug(s)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", s, err)
+		}
+		saved.FeedIDs = append(saved.FeedIDs, feed.ID)
+	}
+	return db.AddSavedSearch(saved)
+}
+
+func listSavedSearches(db store.Store) error {
+	searches, err := db.GetSavedSearches()
+	if err != nil {
+		return err
+	}
+	for _, s := range searches {
+		fmt.Printf("%s\t%s\n", s.Slug, s.Query)
+	}
+	return nil
+}
+
+// addToGroup adds feeds to the group, creating the group if it is new.
+func addToGroup(db store.Store, name string, feedSlugs []string) error {
+	group, err := db.GetGroupByName(name)
+	if err == sql.ErrNoRows {
+		group, err = db.AddGroup(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, s := range feedSlugs {
+		feed, err := db.GetFeedBySlug(s)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", s, err)
+		}
+		err = db.AddFeedToGroup(group.ID, feed.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listGroups(db store.Store) error {
+	groups, err := db.GetGroups()
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		feeds, err := db.GetGroupFeeds(g.ID)
+		if err != nil {
+			return err
+		}
+		slugs := make([]string, 0, len(feeds))
+		for _, f := range feeds {
+			slugs = append(slugs, f.Slug)
+		}
+		fmt.Printf("%s\t%s\n", g.Name, strings.Join(slugs, ", "))
+	}
+	return nil
+}
+
+func removeGroup(db store.Store, name string) error {
+	group, err := db.GetGroupByName(name)
+	if err != nil {
+		return err
+	}
+	return db.DeleteGroup(group.ID)
+}
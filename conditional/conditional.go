@@ -0,0 +1,38 @@
+// Package conditional makes conditional requests of resources fetched
+// before, so servers answer 304 Not Modified instead of sending them again.
+package conditional
+
+import "net/http"
+
+// Validators of the last response of a resource, sent back with the next
+// request as If-None-Match and If-Modified-Since.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// Of returns validators of the response. Responses without ETag and
+// Last-Modified have none.
+func Of(res *http.Response) Validators {
+	return Validators{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+}
+
+// Set makes the request conditional on the validators.
+func (v Validators) Set(req *http.Request) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// NotModified tells the response says the resource has not changed since
+// the validators were taken. A 304 to a request made without validators
+// is not a valid answer.
+func (v Validators) NotModified(res *http.Response) bool {
+	return res.StatusCode == http.StatusNotModified && v != Validators{}
+}
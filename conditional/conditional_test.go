@@ -0,0 +1,65 @@
+package conditional
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidators(t *testing.T) {
+	etag, lastModified := `"v1"`, "Mon, 01 May 2023 12:00:00 GMT"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"etag", map[string]string{"ETag": etag}, http.StatusNotModified},
+		{"last modified", map[string]string{"Last-Modified": lastModified}, http.StatusNotModified},
+		{"both", map[string]string{"ETag": etag, "Last-Modified": lastModified}, http.StatusNotModified},
+		{"none", map[string]string{}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				if (r.Header.Get("If-None-Match") == etag && tt.headers["ETag"] != "") ||
+					(r.Header.Get("If-Modified-Since") == lastModified && tt.headers["Last-Modified"] != "") {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Write([]byte("feed"))
+			}))
+			defer srv.Close()
+
+			res, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			v := Of(res)
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			v.Set(req)
+			res, err = http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("Status %d, want %d", res.StatusCode, tt.want)
+			}
+			if got := v.NotModified(res); got != (tt.want == http.StatusNotModified) {
+				t.Errorf("NotModified() = %v", got)
+			}
+		})
+	}
+}
+
+func TestNotModifiedWithoutValidators(t *testing.T) {
+	res := &http.Response{StatusCode: http.StatusNotModified}
+	if (Validators{}).NotModified(res) {
+		t.Error("Took 304 to an unconditional request as not modified")
+	}
+}
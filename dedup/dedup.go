@@ -0,0 +1,92 @@
+// Package dedup finds records telling the same story.
+//
+// Records are the same story if they link to the same article or if
+// SimHash fingerprints of their content differ in a few bits only.
+package dedup
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Threshold is the maximum number of differing bits of near-duplicates.
+	Threshold = 6
+	// MinWords is the minimum number of words to fingerprint. Shorter texts
+	// match too easily.
+	MinWords = 20
+
+	shingleSize = 2
+)
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SimHash returns the fingerprint of the text made of word shingles. Zero
+// is returned for texts shorter than MinWords.
+func SimHash(text string) uint64 {
+	w := words(text)
+	if len(w) < MinWords {
+		return 0
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(w); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(w[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+
+	var hash uint64
+	for b := 0; b < 64; b++ {
+		if weights[b] > 0 {
+			hash |= 1 << b
+		}
+	}
+	return hash
+}
+
+// Distance is the number of differing bits of fingerprints.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Candidate is a known record a new one is compared with.
+type Candidate struct {
+	StoryID string
+	Link    string
+	Hash    uint64
+}
+
+// Match returns the story of the closest candidate with the same link or
+// similar content.
+func Match(link string, hash uint64, candidates []Candidate) (string, bool) {
+	best := ""
+	bestDistance := Threshold + 1
+	for _, c := range candidates {
+		if link != "" && c.Link == link {
+			return c.StoryID, true
+		}
+		if hash == 0 || c.Hash == 0 {
+			continue
+		}
+		d := Distance(hash, c.Hash)
+		if d < bestDistance {
+			best = c.StoryID
+			bestDistance = d
+		}
+	}
+	return best, best != ""
+}
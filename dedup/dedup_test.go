@@ -0,0 +1,58 @@
+package dedup
+
+import "testing"
+
+const story = `The city council approved on Tuesday a plan to turn the old river port into a public park
+with bike lanes, a swimming pool and a market hall. Construction is expected to start next spring and
+take about three years, according to the mayor's office, which estimates the cost at 40 million euros.`
+
+const rewritten = `The city council approved on Tuesday a plan to turn the old river port into a public park
+with bike lanes, a swimming pool and a food market hall. Construction is expected to start next spring and
+take about three years, according to the mayor's office, which estimates the cost at 40 million euros.`
+
+const other = `Researchers have published a new method of training small language models on consumer
+hardware. The approach splits the model into shards which are trained one after another and merged,
+which cuts the memory needed by an order of magnitude while keeping most of the quality of the baseline.`
+
+func TestSimHash(t *testing.T) {
+	a := SimHash(story)
+	b := SimHash(rewritten)
+	c := SimHash(other)
+	if a == 0 || b == 0 || c == 0 {
+		t.Fatalf("Empty fingerprints %x %x %x", a, b, c)
+	}
+	if d := Distance(a, b); d > Threshold {
+		t.Errorf("Near-duplicates differ in %d bits", d)
+	}
+	if d := Distance(a, c); d <= Threshold {
+		t.Errorf("Different stories differ in %d bits only", d)
+	}
+	if SimHash("Too short to fingerprint") != 0 {
+		t.Errorf("Short text is fingerprinted")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	candidates := []Candidate{
+		{StoryID: "1", Link: "https://example.com/a", Hash: SimHash(other)},
+		{StoryID: "2", Link: "https://example.org/b", Hash: SimHash(story)},
+	}
+
+	tests := []struct {
+		link  string
+		hash  uint64
+		story string
+	}{
+		{"https://example.com/a", 0, "1"},
+		{"https://example.net/c", SimHash(rewritten), "2"},
+		{"https://example.net/c", 0, ""},
+		{"https://example.net/c", SimHash(story) ^ 0xffff, ""},
+	}
+
+	for _, test := range tests {
+		id, ok := Match(test.link, test.hash, candidates)
+		if id != test.story || ok != (test.story != "") {
+			t.Errorf("Match of %s is %q, want %q", test.link, id, test.story)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package events passes news of feeder, like added records, extracted
+// pages and failed fetches, to live subscribers.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+const (
+	RecordCreated = "record.created"
+	PageExtracted = "page.extracted"
+	FeedFailed    = "feed.failed"
+
+	// historySize is the number of recent events replayed to subscribers
+	// reconnecting after an event they have seen.
+	historySize = 256
+	// bufferSize is the number of events a subscriber may lag behind.
+	// Events are dropped for subscribers further behind.
+	bufferSize = 64
+)
+
+// Types lists types of events published by feeder.
+var Types = []string{RecordCreated, PageExtracted, FeedFailed}
+
+// Known tells if events of the type are published.
+func Known(eventType string) bool {
+	return contains(Types, eventType)
+}
+
+type Event struct {
+	ID   int64     `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Feed string    `json:"feed"`
+	Tags []string  `json:"tags,omitempty"`
+
+	Record *internal.Record `json:"record,omitempty"`
+	// Url and Title of the extracted page.
+	Url   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+	// Error of the failed fetch.
+	Error string `json:"error,omitempty"`
+}
+
+// Filter selects events by type, feed slug and tag. Empty lists match
+// any event.
+type Filter struct {
+	Types []string
+	Feeds []string
+	Tags  []string
+}
+
+func (f Filter) Match(e Event) bool {
+	if len(f.Types) > 0 && !contains(f.Types, e.Type) {
+		return false
+	}
+	if len(f.Feeds) > 0 && !contains(f.Feeds, e.Feed) {
+		return false
+	}
+	if len(f.Tags) > 0 {
+		for _, tag := range e.Tags {
+			if contains(f.Tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	filter Filter
+	bus    *Bus
+}
+
+// Close stops the subscription and closes its channel.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.c)
+	}
+}
+
+// Bus passes published events to subscribers. Publishing never blocks on
+// subscribers, events are dropped for subscribers not keeping up. Hooks
+// get every event.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  int64
+	history []Event
+	subs    map[*Subscription]struct{}
+	hooks   []func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Hook calls fn with every event published from now on. Hooks are
+// called by Publish, so events are not lost to them, and they have to be
+// quick.
+func (b *Bus) Hook(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hooks = append(b.hooks, fn)
+}
+
+// Publish gives the event an id and the current time, passes it to
+// subscribers and calls hooks with it. Publishing to a nil bus does
+// nothing.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	for _, hook := range b.publish(&e) {
+		hook(e)
+	}
+}
+
+// publish passes the event to subscribers and returns hooks to call
+// without the bus locked.
+func (b *Bus) publish(e *Event) []func(Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID += 1
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.history = append(b.history, *e)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(*e) {
+			continue
+		}
+		select {
+		case sub.c <- *e:
+		default:
+		}
+	}
+	return b.hooks
+}
+
+// Subscribe passes events matching the filter to the subscription. Recent
+// events published after the event with lastID are passed first, lastID 0
+// passes new events only.
+func (b *Bus) Subscribe(filter Filter, lastID int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, bufferSize+historySize)
+	sub := &Subscription{
+		C:      c,
+		c:      c,
+		filter: filter,
+		bus:    b,
+	}
+	if lastID > 0 {
+		for _, e := range b.history {
+			if e.ID > lastID && filter.Match(e) {
+				c <- e
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
@@ -0,0 +1,98 @@
+package events
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	e := Event{Type: RecordCreated, Feed: "news", Tags: []string{"go", "db"}}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"type", Filter{Types: []string{RecordCreated}}, true},
+		{"other type", Filter{Types: []string{PageExtracted}}, false},
+		{"feed", Filter{Feeds: []string{"blog", "news"}}, true},
+		{"other feed", Filter{Feeds: []string{"blog"}}, false},
+		{"tag", Filter{Tags: []string{"db"}}, true},
+		{"other tag", Filter{Tags: []string{"rust"}}, false},
+		{"feed and other tag", Filter{Feeds: []string{"news"}, Tags: []string{"rust"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(e); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(Filter{Feeds: []string{"news"}}, 0)
+
+	bus.Publish(Event{Type: RecordCreated, Feed: "blog"})
+	bus.Publish(Event{Type: RecordCreated, Feed: "news"})
+
+	e := <-sub.C
+	if e.Feed != "news" || e.ID != 2 {
+		t.Errorf("Got event %d of %s, want 2 of news", e.ID, e.Feed)
+	}
+	if e.Time.IsZero() {
+		t.Errorf("Event has no time")
+	}
+
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Errorf("Channel is open after Close()")
+	}
+	sub.Close()
+	bus.Publish(Event{Type: RecordCreated, Feed: "news"})
+}
+
+func TestBusReplay(t *testing.T) {
+	bus := NewBus()
+	for i := 0; i < 3; i++ {
+		bus.Publish(Event{Type: RecordCreated, Feed: "news"})
+	}
+
+	sub := bus.Subscribe(Filter{}, 1)
+	defer sub.Close()
+	for _, want := range []int64{2, 3} {
+		if e := <-sub.C; e.ID != want {
+			t.Errorf("Replayed event %d, want %d", e.ID, want)
+		}
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("Unexpected event %d", e.ID)
+	default:
+	}
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(Filter{}, 0)
+	defer sub.Close()
+	for i := 0; i < cap(sub.c)+10; i++ {
+		bus.Publish(Event{Type: RecordCreated})
+	}
+	if len(sub.C) != cap(sub.c) {
+		t.Errorf("Buffered %d events, want %d", len(sub.C), cap(sub.c))
+	}
+}
+
+func TestBusHook(t *testing.T) {
+	bus := NewBus()
+	var ids []int64
+	bus.Hook(func(e Event) {
+		ids = append(ids, e.ID)
+	})
+	n := bufferSize + historySize + 10
+	for i := 0; i < n; i++ {
+		bus.Publish(Event{Type: RecordCreated})
+	}
+	if len(ids) != n || ids[0] != 1 || ids[n-1] != int64(n) {
+		t.Errorf("Hook got %d events, want %d", len(ids), n)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+	"github.com/tmshv/feeder/warc"
+)
+
+func exportWarc(db store.Store, output string, feedSlug string, since time.Time, until time.Time) error {
+	filter := internal.PageFilter{
+		Since: since,
+		Until: until,
+	}
+	if feedSlug != "" {
+		feed, err := db.GetFeedBySlug(feedSlug)
+		if err != nil {
+			return err
+		}
+		filter.FeedID = feed.ID
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bw := bufio.NewWriter(file)
+	w := warc.NewWriter(bw, strings.HasSuffix(output, ".gz"))
+	infoID, err := w.WriteWarcinfo(filepath.Base(output), []warc.Field{
+		{Name: "software", Value: userAgent},
+		{Name: "format", Value: "WARC File Format 1.1"},
+	})
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	it := db.IteratePages(filter, 0)
+	for it.Next() {
+		page := it.Page()
+		u, err := url.Parse(page.Url)
+		if err != nil {
+			log.Printf("Skip page with bad url %s: %v", page.Url, err)
+			continue
+		}
+
+		for _, r := range pageWarcRecords(&page, u) {
+			r.Set("WARC-Warcinfo-ID", infoID)
+			err := w.WriteRecord(r)
+			if err != nil {
+				return err
+			}
+		}
+		count += 1
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Exported %d pages to %s", count, output)
+	return nil
+}
+
+// pageWarcRecords returns a response and request pair for pages fetched
+// with captured headers, or a single resource record for older pages.
+func pageWarcRecords(page *internal.Page, u *url.URL) []*warc.Record {
+	body := []byte(page.Html)
+
+	if page.ResponseHeaders == "" {
+		r := warc.NewRecord(warc.TypeResource, page.CreatedAt, body)
+		r.Set("WARC-Target-URI", page.Url)
+		r.Set("Content-Type", "text/html")
+		r.Set("WARC-Payload-Digest", warc.Digest(body))
+		return []*warc.Record{r}
+	}
+
+	res := warc.NewRecord(warc.TypeResponse, page.CreatedAt, warc.HTTPResponse(page.Status, parseHeader(page.ResponseHeaders), body))
+	res.Set("WARC-Target-URI", page.Url)
+	res.Set("Content-Type", "application/http;msgtype=response")
+	res.Set("WARC-Payload-Digest", warc.Digest(body))
+
+	req := warc.NewRecord(warc.TypeRequest, page.CreatedAt, warc.HTTPRequest(http.MethodGet, u, parseHeader(page.RequestHeaders)))
+	req.Set("WARC-Target-URI", page.Url)
+	req.Set("Content-Type", "application/http;msgtype=request")
+	req.Set("WARC-Concurrent-To", res.Get("WARC-Record-ID"))
+
+	return []*warc.Record{res, req}
+}
+
+func parseHeader(raw string) http.Header {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(raw + "\r\n")))
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		return http.Header{}
+	}
+	return http.Header(h)
+}
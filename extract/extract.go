@@ -0,0 +1,165 @@
+package extract
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cixtor/readability"
+	"github.com/tmshv/feeder/internal"
+)
+
+type Result struct {
+	Title       string
+	PublishedAt time.Time
+	Html        string
+	Content     string
+	NextUrl     string
+}
+
+// Extract finds the article in the html page and converts it to Markdown.
+//
+// Elements matched by rules.Remove are dropped first. If rules.Content
+// matches anything it is taken as the article as is, otherwise readability
+// guesses the article from what is left of the page.
+func Extract(html string, pageUrl string, rules internal.ExtractRules) (Result, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	if rules.Title != "" {
+		result.Title = strings.TrimSpace(doc.Find(rules.Title).First().Text())
+	}
+	if rules.Date != "" {
+		result.PublishedAt = findDate(doc.Find(rules.Date).First())
+	}
+
+	// Pagination is usually outside of the article, so look for it before
+	// anything is removed.
+	result.NextUrl = findNextUrl(doc, pageUrl, rules)
+
+	for _, sel := range rules.Remove {
+		doc.Find(sel).Remove()
+	}
+
+	if rules.Content != "" {
+		content := doc.Find(rules.Content)
+		if content.Length() > 0 {
+			var buf strings.Builder
+			content.Each(func(_ int, s *goquery.Selection) {
+				h, err := goquery.OuterHtml(s)
+				if err == nil {
+					buf.WriteString(h)
+				}
+			})
+			result.Html = buf.String()
+		}
+	}
+
+	if result.Html == "" {
+		cleaned, err := doc.Html()
+		if err != nil {
+			return Result{}, err
+		}
+
+		// Readability keeps parsing state, so every call gets its own parser.
+		r := readability.New()
+		a, err := r.Parse(strings.NewReader(cleaned), pageUrl)
+		if err != nil {
+			return Result{}, err
+		}
+		result.Html = a.Content
+		if result.Title == "" {
+			result.Title = a.Title
+		}
+	}
+
+	result.Content, err = HtmlToMd(result.Html)
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+func HtmlToMd(html string) (string, error) {
+	converter := md.NewConverter("", true, nil)
+	return converter.ConvertString(html)
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"02.01.2006",
+}
+
+// findDate reads a date from datetime or content attributes of the element
+// and falls back to its text.
+func findDate(s *goquery.Selection) time.Time {
+	values := []string{}
+	for _, attr := range []string{"datetime", "content"} {
+		if v, ok := s.Attr(attr); ok {
+			values = append(values, v)
+		}
+	}
+	values = append(values, s.Text())
+
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		for _, layout := range dateLayouts {
+			t, err := time.Parse(layout, v)
+			if err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// findNextUrl looks for the link to the next page of a multi-page article.
+// The selector of the feed goes first, rel="next" links are the fallback.
+// Blogs link single posts to the next post with rel="next" too, so the
+// fallback is used only if the rules of the feed enable pagination.
+func findNextUrl(doc *goquery.Document, pageUrl string, rules internal.ExtractRules) string {
+	selectors := []string{}
+	if rules.NextPage != "" {
+		selectors = append(selectors, rules.NextPage)
+	}
+	if paginated(rules) {
+		selectors = append(selectors, `link[rel~="next"]`, `a[rel~="next"]`)
+	}
+
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return ""
+	}
+	for _, sel := range selectors {
+		href, ok := doc.Find(sel).First().Attr("href")
+		if !ok || strings.TrimSpace(href) == "" {
+			continue
+		}
+		next, err := base.Parse(strings.TrimSpace(href))
+		if err != nil {
+			continue
+		}
+		next.Fragment = ""
+		return next.String()
+	}
+	return ""
+}
+
+// paginated tells if articles of the feed are split into pages, which is
+// set with the selector of the next page or the number of pages.
+func paginated(rules internal.ExtractRules) bool {
+	return rules.NextPage != "" || rules.MaxPages > 0
+}
@@ -0,0 +1,66 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+const page = `<html>
+<head><title>Site | Story</title></head>
+<body>
+<h1 class="headline">Story</h1>
+<time class="date" datetime="2023-05-01T10:00:00Z">May 1</time>
+<div class="post">
+  <p>First paragraph of the story.</p>
+  <div class="share">Share this</div>
+  <p>Second paragraph of the story.</p>
+</div>
+<div class="comments"><p>Great post!</p></div>
+</body>
+</html>`
+
+func TestExtractWithRules(t *testing.T) {
+	rules := internal.ExtractRules{
+		Content: ".post",
+		Remove:  []string{".share"},
+		Title:   ".headline",
+		Date:    ".date",
+	}
+
+	res, err := Extract(page, "https://example.com/story", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Title != "Story" {
+		t.Errorf("Wrong title %q", res.Title)
+	}
+	if !res.PublishedAt.Equal(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong date %v", res.PublishedAt)
+	}
+	if !strings.Contains(res.Content, "Second paragraph") {
+		t.Errorf("Content is missing: %q", res.Content)
+	}
+	if strings.Contains(res.Content, "Share this") {
+		t.Errorf("Removed element is in content: %q", res.Content)
+	}
+	if strings.Contains(res.Content, "Great post") {
+		t.Errorf("Comments are in content: %q", res.Content)
+	}
+}
+
+func TestFindDateText(t *testing.T) {
+	res, err := Extract(`<p class="d">January 2, 2006</p><p>text</p>`, "https://example.com", internal.ExtractRules{
+		Content: "p",
+		Date:    ".d",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PublishedAt.Format("2006-01-02") != "2006-01-02" {
+		t.Errorf("Wrong date %v", res.PublishedAt)
+	}
+}
@@ -0,0 +1,72 @@
+package extract
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+const DefaultMaxPages = 10
+
+// Follow extracts the article from the page and from the pages it continues
+// on, and merges their content. Pages are read with load, which may fetch
+// them from the network or from the store. Only pages on the same host are
+// followed, at most rules.MaxPages of them in total.
+//
+// The urls of all read pages are returned along with the result.
+func Follow(pageUrl string, rules internal.ExtractRules, load func(string) (string, error)) (Result, []string, error) {
+	html, err := load(pageUrl)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	result, err := Extract(html, pageUrl, rules)
+	if err != nil {
+		return Result{}, nil, err
+	}
+
+	maxPages := rules.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	urls := []string{pageUrl}
+	visited := map[string]bool{pageUrl: true}
+	contents := []string{result.Content}
+	next := result.NextUrl
+	for next != "" && len(urls) < maxPages && !visited[next] && sameHost(pageUrl, next) {
+		visited[next] = true
+
+		html, err := load(next)
+		if err != nil {
+			log.Printf("Failed to load next page %s: %v", next, err)
+			break
+		}
+		page, err := Extract(html, next, rules)
+		if err != nil {
+			log.Printf("Failed to extract next page %s: %v", next, err)
+			break
+		}
+
+		urls = append(urls, next)
+		contents = append(contents, page.Content)
+		next = page.NextUrl
+	}
+
+	result.Content = strings.Join(contents, "\n\n")
+	result.NextUrl = ""
+	return result, urls, nil
+}
+
+func sameHost(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
@@ -0,0 +1,92 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+func articlePage(text string, next string) string {
+	link := ""
+	if next != "" {
+		link = fmt.Sprintf(`<a rel="next" href="%s">Next</a>`, next)
+	}
+	return fmt.Sprintf(`<html><body><div class="post"><p>%s</p></div><nav>%s</nav></body></html>`, text, link)
+}
+
+func TestFollow(t *testing.T) {
+	site := map[string]string{
+		"https://example.com/story":        articlePage("Part one.", "/story?page=2"),
+		"https://example.com/story?page=2": articlePage("Part two.", "https://example.com/story?page=3#top"),
+		"https://example.com/story?page=3": articlePage("Part three.", "https://other.com/story"),
+	}
+	load := func(url string) (string, error) {
+		html, ok := site[url]
+		if !ok {
+			return "", fmt.Errorf("%s not found", url)
+		}
+		return html, nil
+	}
+
+	res, urls, err := Follow("https://example.com/story", internal.ExtractRules{Content: ".post", MaxPages: DefaultMaxPages}, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 3 {
+		t.Errorf("Expected 3 pages, got %v", urls)
+	}
+	for _, part := range []string{"Part one.", "Part two.", "Part three."} {
+		if !strings.Contains(res.Content, part) {
+			t.Errorf("%q is missing in %q", part, res.Content)
+		}
+	}
+}
+
+func TestFollowMaxPages(t *testing.T) {
+	load := func(url string) (string, error) {
+		return articlePage("Again.", url+"x"), nil
+	}
+
+	_, urls, err := Follow("https://example.com/a", internal.ExtractRules{Content: ".post", MaxPages: 4}, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 4 {
+		t.Errorf("Expected 4 pages, got %d", len(urls))
+	}
+}
+
+func TestFollowSelector(t *testing.T) {
+	html := `<html><body><div class="post"><p>Text.</p></div><a class="more" href="/p/2">More</a></body></html>`
+	res, err := Extract(html, "https://example.com/p/1", internal.ExtractRules{Content: ".post", NextPage: "a.more"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.NextUrl != "https://example.com/p/2" {
+		t.Errorf("Wrong next url %q", res.NextUrl)
+	}
+}
+
+func TestFollowSinglePost(t *testing.T) {
+	// Blogs link posts to the next post with rel="next".
+	html := `<html><head><link rel="next" href="/2024/next-post"></head><body><div class="post"><p>Post.</p></div></body></html>`
+	load := func(url string) (string, error) {
+		if url != "https://example.com/2024/post" {
+			t.Errorf("Loaded %s", url)
+		}
+		return html, nil
+	}
+
+	res, urls, err := Follow("https://example.com/2024/post", internal.ExtractRules{Content: ".post"}, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 {
+		t.Errorf("Expected the post only, got %v", urls)
+	}
+	if strings.Count(res.Content, "Post.") != 1 {
+		t.Errorf("Wrong content %q", res.Content)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/tmshv/feeder/extract"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+type ExtractFlags struct {
+	Content  string   `help:"CSS selector of the article content. Readability is used if nothing matches."`
+	Remove   []string `help:"CSS selectors of elements to remove before extraction."`
+	Title    string   `help:"CSS selector of the article title."`
+	Date     string   `help:"CSS selector of the article date."`
+	NextPage string   `help:"CSS selector of the link to the next page of the article."`
+	MaxPages int      `help:"Maximum number of pages of one article to follow. Set it to follow rel=next links without --next-page."`
+}
+
+// apply overrides rules with the flags that are set.
+func (f ExtractFlags) apply(rules internal.ExtractRules) internal.ExtractRules {
+	if f.Content != "" {
+		rules.Content = f.Content
+	}
+	if len(f.Remove) > 0 {
+		rules.Remove = f.Remove
+	}
+	if f.Title != "" {
+		rules.Title = f.Title
+	}
+	if f.Date != "" {
+		rules.Date = f.Date
+	}
+	if f.NextPage != "" {
+		rules.NextPage = f.NextPage
+	}
+	if f.MaxPages > 0 {
+		rules.MaxPages = f.MaxPages
+	}
+	return rules
+}
+
+// fetchArticle fetches the page along with the pages the article continues
+// on. Fetched pages are returned in the order they were read.
+func fetchArticle(url string, rules internal.ExtractRules) ([]internal.Page, extract.Result, error) {
+	fetched := map[string]internal.Page{}
+	load := func(u string) (string, error) {
+		page, err := fetchPage(u)
+		if err != nil {
+			return "", err
+		}
+		fetched[u] = page
+		return page.Html, nil
+	}
+
+	article, urls, err := extract.Follow(url, rules, load)
+	if err != nil {
+		return nil, extract.Result{}, err
+	}
+
+	pages := make([]internal.Page, 0, len(urls))
+	for _, u := range urls {
+		pages = append(pages, fetched[u])
+	}
+	return pages, article, nil
+}
+
+func testExtract(db store.Store, url string, feedSlug string, flags ExtractFlags) error {
+	var rules internal.ExtractRules
+	if feedSlug != "" {
+		feed, err := db.GetFeedBySlug(feedSlug)
+		if err != nil {
+			return err
+		}
+		rules = feed.Extract
+	}
+	rules = flags.apply(rules)
+
+	pages, article, err := fetchArticle(url, rules)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Title: %s\n", article.Title)
+	fmt.Printf("Pages: %d\n", len(pages))
+	if !article.PublishedAt.IsZero() {
+		fmt.Printf("Date: %s\n", article.PublishedAt.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println()
+	fmt.Println(article.Content)
+	return nil
+}
+
+// setExtractRules replaces extraction rules of the feed with the flags.
+func setExtractRules(db store.Store, slug string, flags ExtractFlags) error {
+	feed, err := db.GetFeedBySlug(slug)
+	if err != nil {
+		return err
+	}
+	return db.UpdateFeedExtractRules(feed.ID, flags.apply(internal.ExtractRules{}))
+}
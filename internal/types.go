@@ -4,27 +4,318 @@ import "time"
 
 type Feed struct {
 	ID        string    `json:"id" db:"id"`
+	Num       int64     `json:"num" db:"num"`
 	Slug      string    `json:"slug" db:"slug"`
 	Url       string    `json:"url" db:"url"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
 	RefreshMs int64     `json:"refreshMs" db:"refresh_ms"`
+
+	Extract ExtractRules `json:"extract" db:"extract_rules"`
+}
+
+// ExtractRules tune article extraction for a feed whose pages readability
+// does not handle well. Every field but MaxPages is a CSS selector. Next
+// pages of articles are followed only if NextPage or MaxPages is set.
+type ExtractRules struct {
+	Content  string   `json:"content,omitempty"`
+	Remove   []string `json:"remove,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Date     string   `json:"date,omitempty"`
+	NextPage string   `json:"next_page,omitempty"`
+	MaxPages int      `json:"max_pages,omitempty"`
 }
 
 type Record struct {
-	ID          string    `json:"id" db:"id"`
+	ID string `json:"id" db:"id"`
+	// Num is a short sequential id for clients that need integer ids.
+	Num         int64     `json:"num" db:"num"`
 	FeedID      string    `json:"feed_id" db:"feed_id"`
 	Title       string    `json:"title" db:"title"`
 	Description string    `json:"description" db:"description"`
 	Content     string    `json:"content" db:"content"`
 	PublishedAt time.Time `json:"published_at" db:"published_at"`
 	Link        string    `json:"link" db:"link"`
+	// CanonicalLink is the article the link leads to after redirects and
+	// wrappers. Link keeps the link given by the feed.
+	CanonicalLink string `json:"canonical_link" db:"canonical_link"`
+	// LinkKey is the canonical form of the link given by the feed. Items
+	// linking to the same page differently are stored once by it.
+	LinkKey string `json:"-" db:"link_key"`
+	// Extracted tells Content is markdown extracted from the page of the
+	// record, not the HTML given by the feed.
+	Extracted bool `json:"-" db:"-"`
+
+	Tags       []string  `json:"tags" db:"-"`
+	ReadAt     time.Time `json:"read_at" db:"read_at"`
+	StarredAt  time.Time `json:"starred_at" db:"starred_at"`
+	ArchivedAt time.Time `json:"archived_at" db:"archived_at"`
+	SkipPage   bool      `json:"skip_page" db:"skip_page"`
+
+	// Records of different feeds telling the same story share StoryID.
+	// A record is a story of its own until a duplicate is found.
+	Simhash uint64 `json:"-" db:"simhash"`
+	StoryID string `json:"story_id" db:"story_id"`
+
+	// Feed the record came from, filled in aggregated listings.
+	FeedSlug string `json:"feed_slug,omitempty" db:"feed_slug"`
+	FeedUrl  string `json:"feed_url,omitempty" db:"feed_url"`
+}
+
+type RecordFilter struct {
+	FeedIDs []string
+	GroupID string
+	// UserID limits records to subscriptions of the user and gives the
+	// read state of the user.
+	UserID string
+	// Unread lists records neither read nor archived.
+	Unread  bool
+	Starred bool
+	// Nums lists records with the sequential ids only.
+	Nums []int64
+	// AfterNum and BeforeNum page through records by sequential ids, in
+	// ascending and descending order.
+	AfterNum  int64
+	BeforeNum int64
+	// Before lists records published before the time to page through them.
+	// With BeforeNum set too, records published at the time with smaller
+	// sequential ids follow as well, so records published at the same time
+	// are not skipped.
+	Before time.Time
+	Since  time.Time
+	Limit  int
+}
+
+// Group is a folder of feeds served as one merged feed.
+type Group struct {
+	ID        string    `json:"id" db:"id"`
+	Num       int64     `json:"num" db:"num"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 type Page struct {
+	Url             string    `json:"url" db:"url"`
+	CanonicalUrl    string    `json:"canonical_url" db:"canonical_url"`
+	Html            string    `json:"html" db:"html"`
+	Content         string    `json:"content" db:"content"`
+	Title           string    `json:"title" db:"title"`
+	PublishedAt     time.Time `json:"published_at" db:"published_at"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	Status          int       `json:"status" db:"status"`
+	RequestHeaders  string    `json:"request_headers" db:"request_headers"`
+	ResponseHeaders string    `json:"response_headers" db:"response_headers"`
+	// Index is the number of the page of a multi-page article, 0 for the
+	// first one. Next pages are kept to rebuild the article from the first
+	// one without going to the network.
+	Index int `json:"index" db:"page_index"`
+}
+
+type PageFilter struct {
+	FeedID string
+	Since  time.Time
+	Until  time.Time
+	// First leaves next pages of multi-page articles out.
+	First bool
+}
+
+type SearchFilter struct {
+	FeedIDs []string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	// Newest orders results by publication date instead of relevance.
+	Newest bool
+}
+
+type SearchResult struct {
+	Record
+	// Snippet is a fragment of the matched text with matches wrapped in <mark>.
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// SavedSearch is a named query served like a feed.
+type SavedSearch struct {
+	ID        string    `json:"id" db:"id"`
+	Slug      string    `json:"slug" db:"slug"`
+	Title     string    `json:"title" db:"title"`
+	Query     string    `json:"query" db:"query"`
+	FeedIDs   []string  `json:"feed_ids" db:"feed_ids"`
+	Since     time.Time `json:"since" db:"since"`
+	Until     time.Time `json:"until" db:"until"`
+	WithinMs  int64     `json:"within_ms" db:"within_ms"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Filter returns the search filter of the saved search at the moment. A
+// relative window set with WithinMs narrows the fixed date range.
+func (s *SavedSearch) Filter(now time.Time) SearchFilter {
+	filter := SearchFilter{
+		FeedIDs: s.FeedIDs,
+		Since:   s.Since,
+		Until:   s.Until,
+	}
+	if s.WithinMs > 0 {
+		since := now.Add(-time.Duration(s.WithinMs) * time.Millisecond)
+		if since.After(filter.Since) {
+			filter.Since = since
+		}
+	}
+	return filter
+}
+
+const (
+	RuleStageRecord = "record"
+	RuleStagePage   = "page"
+)
+
+const (
+	RuleActionDrop     = "drop"
+	RuleActionTag      = "tag"
+	RuleActionMarkRead = "mark_read"
+	RuleActionRewrite  = "rewrite"
+	RuleActionStrip    = "strip"
+	RuleActionSkipPage = "skip_page"
+)
+
+// Rule filters or changes records matching its expression. Rules with no
+// feed are global.
+//
+// Record rules run before a new record is added. Page rules run when the
+// page of the record is fetched: strip before extraction, others after it.
+type Rule struct {
+	ID        string    `json:"id" db:"id"`
+	FeedID    string    `json:"feed_id" db:"feed_id"`
+	Name      string    `json:"name" db:"name"`
+	Stage     string    `json:"stage" db:"stage"`
+	Expr      string    `json:"expr" db:"expr"`
+	Action    string    `json:"action" db:"action"`
+	Field     string    `json:"field" db:"field"`
+	Pattern   string    `json:"pattern" db:"pattern"`
+	Value     string    `json:"value" db:"value"`
+	Position  int       `json:"position" db:"position"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type User struct {
+	ID           string `json:"id" db:"id"`
+	Name         string `json:"name" db:"name"`
+	PasswordHash string `json:"-" db:"password_hash"`
+	// FeverKey is the hash of the key Fever API clients send, md5 of
+	// name:password with a password made for Fever clients.
+	FeverKey  string    `json:"-" db:"fever_key"`
+	Admin     bool      `json:"admin" db:"admin"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+const (
+	// TokenKindApi tokens sign in to the API.
+	TokenKindApi = "api"
+	// TokenKindFeed tokens are secret parts of private feed URLs. They
+	// give read-only access to feeds of the user.
+	TokenKindFeed = "feed"
+)
+
+// Token is a secret a user signs in with. Only the hash of the token is
+// stored.
+type Token struct {
+	ID         string    `json:"id" db:"id"`
+	UserID     string    `json:"user_id" db:"user_id"`
+	Kind       string    `json:"kind" db:"kind"`
+	Name       string    `json:"name" db:"name"`
+	Hash       string    `json:"-" db:"token_hash"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+}
+
+const (
+	RecordStateRead     = "read"
+	RecordStateStarred  = "starred"
+	RecordStateArchived = "archived"
+)
+
+// Webhook posts events to the url, signed with the secret. Empty filters
+// match any feed, tag and event type.
+type Webhook struct {
+	ID        string    `json:"id" db:"id"`
 	Url       string    `json:"url" db:"url"`
-	Html      string    `json:"html" db:"html"`
-	Content   string    `json:"content" db:"content"`
+	Secret    string    `json:"-" db:"secret"`
+	Feeds     []string  `json:"feeds" db:"feeds"`
+	Tags      []string  `json:"tags" db:"tags"`
+	Events    []string  `json:"events" db:"events"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// WebhookEvent is an event waiting in the outbox to be delivered to a
+// webhook. It stays there until the webhook accepts it or attempts run
+// out, so events are delivered after restarts too.
+type WebhookEvent struct {
+	ID         int64  `json:"id" db:"id"`
+	WebhookID  string `json:"webhook_id" db:"webhook_id"`
+	DeliveryID string `json:"delivery_id" db:"delivery_id"`
+	EventType  string `json:"event_type" db:"event_type"`
+	Payload    string `json:"payload" db:"payload"`
+	// Attempts made to deliver the event so far.
+	Attempts      int       `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery is an attempt to post an event to a webhook. Attempts
+// to deliver the same event share DeliveryID. The event itself is kept in
+// the outbox until it is delivered only.
+type WebhookDelivery struct {
+	ID         string `json:"id" db:"id"`
+	WebhookID  string `json:"webhook_id" db:"webhook_id"`
+	DeliveryID string `json:"delivery_id" db:"delivery_id"`
+	EventType  string `json:"event_type" db:"event_type"`
+	Attempt    int    `json:"attempt" db:"attempt"`
+	// Status of the response, 0 if there is none.
+	Status    int       `json:"status" db:"status"`
+	Error     string    `json:"error" db:"error"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+const (
+	// WebSubPending subscriptions wait for the hub to verify them.
+	WebSubPending = "pending"
+	WebSubActive  = "active"
+	// WebSubFailed subscriptions were rejected or the hub did not answer.
+	WebSubFailed = "failed"
+)
+
+// WebSubSubscription is a subscription to updates of a feed pushed by its
+// WebSub hub.
+type WebSubSubscription struct {
+	FeedID string `json:"feed_id" db:"feed_id"`
+	Hub    string `json:"hub" db:"hub"`
+	Topic  string `json:"topic" db:"topic"`
+	Secret string `json:"-" db:"secret"`
+	State  string `json:"state" db:"state"`
+	// Requested is the mode of the request the hub has not verified yet,
+	// subscribe or unsubscribe. Hubs are answered for it only.
+	Requested string    `json:"requested" db:"requested"`
+	Lease     int64     `json:"lease_seconds" db:"lease_seconds"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	Error     string    `json:"error" db:"error"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Active tells if the hub pushes updates now.
+func (s WebSubSubscription) Active() bool {
+	return s.State == WebSubActive && time.Now().Before(s.ExpiresAt)
+}
+
+// HubSubscription is a subscriber of a feed served by feeder, pushed the
+// feed when it changes. The feed is the slug of a feed or saved search
+// and the format is the one asked in the topic URL, empty if none.
+type HubSubscription struct {
+	Feed      string    `json:"feed" db:"feed"`
+	Format    string    `json:"format" db:"format"`
+	Callback  string    `json:"callback" db:"callback"`
+	Secret    string    `json:"-" db:"secret"`
+	Lease     int64     `json:"lease_seconds" db:"lease_seconds"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -16,23 +18,30 @@ import (
 
 	"github.com/alecthomas/kong"
 	"github.com/gilliek/go-opml/opml"
-	"github.com/gofiber/fiber/v2"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tmshv/feeder/blob"
+	"github.com/tmshv/feeder/conditional"
+	"github.com/tmshv/feeder/events"
 	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/metrics"
+	"github.com/tmshv/feeder/server"
 	"github.com/tmshv/feeder/store"
 	"github.com/tmshv/feeder/utils"
+	"github.com/tmshv/feeder/webhook"
+	"github.com/tmshv/feeder/websub"
 
-	"github.com/cixtor/readability"
 	"github.com/gosimple/slug"
 	"github.com/mmcdole/gofeed"
-	jsonfeed "github.com/mmcdole/gofeed/json"
-
-	md "github.com/JohannesKaufmann/html-to-markdown"
 )
 
 var cli struct {
+	Blobs     string   `help:"Directory of the compressed page blob store." default:"blobs" type:"path"`
+	DropParam []string `help:"Extra query parameters dropped from links. A trailing * matches any suffix."`
+	KeepHttp  bool     `help:"Do not upgrade http links to https."`
+	PublicUrl string   `help:"URL feeder is reachable at. Links of served feeds and WebSub callbacks are made of it, http://127.0.0.1:3000 if not set. Feeds are subscribed to WebSub hubs only if it is set."`
+
 	Add struct {
 		// Force     bool `help:"Force removal."`
 		// Recursive bool `help:"Recursively remove files."`
@@ -42,21 +51,261 @@ var cli struct {
 
 	Serve struct {
 		// Paths []string `arg:"" optional:"" name:"path" help:"Paths to list." type:"path"`
+		NoAuth bool `help:"Serve feeds and mutation endpoints without authentication."`
 	} `cmd:"" help:"Serve feeder"`
+
+	Export struct {
+		Warc struct {
+			Output string    `arg:"" name:"output" help:"WARC file to write. Records are gzipped if it ends with .gz." type:"path"`
+			Feed   string    `help:"Export only pages of the feed with this slug."`
+			Since  time.Time `help:"Export only pages fetched since this date." format:"2006-01-02"`
+			Until  time.Time `help:"Export only pages fetched before this date." format:"2006-01-02"`
+		} `cmd:"" help:"Export archived pages to a WARC file"`
+	} `cmd:"" help:"Export feeder data"`
+
+	Reprocess struct {
+		Feed    string    `help:"Reprocess only pages of the feed with this slug."`
+		Since   time.Time `help:"Reprocess only pages fetched since this date." format:"2006-01-02"`
+		Workers int       `help:"Number of parallel workers." default:"4"`
+		Resume  bool      `help:"Continue after the last page of the previous run with the same --feed and --since."`
+	} `cmd:"" help:"Extract content of stored pages again"`
+
+	Search struct {
+		Query string `arg:"" name:"query" help:"FTS5 query, e.g. 'sqlite AND (fts OR search)'."`
+		Feed  string `help:"Search only records of the feed with this slug."`
+		Limit int    `help:"Maximum number of results." default:"20"`
+	} `cmd:"" help:"Search records and pages"`
+
+	Saved struct {
+		Add struct {
+			Slug   string        `arg:"" name:"slug" help:"Slug of the feed made of the search."`
+			Query  string        `arg:"" name:"query" help:"FTS5 query."`
+			Title  string        `help:"Title of the feed."`
+			Feed   []string      `help:"Search only records of the feeds with these slugs."`
+			Since  time.Time     `help:"Search only records published since this date." format:"2006-01-02"`
+			Until  time.Time     `help:"Search only records published before this date." format:"2006-01-02"`
+			Within time.Duration `help:"Search only records published within this time until now, e.g. 168h."`
+		} `cmd:"" help:"Save a search as a feed"`
+		List struct {
+		} `cmd:"" help:"List saved searches"`
+		Rm struct {
+			Slug string `arg:"" name:"slug" help:"Slug of the saved search."`
+		} `cmd:"" help:"Remove a saved search"`
+	} `cmd:"" help:"Manage saved searches served as feeds"`
+
+	Group struct {
+		Add struct {
+			Name  string   `arg:"" name:"name" help:"Group name."`
+			Feeds []string `arg:"" name:"feed" help:"Slugs of feeds to add to the group."`
+		} `cmd:"" help:"Add feeds to a group"`
+		List struct {
+		} `cmd:"" help:"List groups"`
+		Rm struct {
+			Name string `arg:"" name:"name" help:"Group name."`
+		} `cmd:"" help:"Remove a group"`
+	} `cmd:"" help:"Manage groups of feeds served as one feed"`
+
+	Extract struct {
+		Test struct {
+			Url  string `arg:"" name:"url" help:"Page to extract."`
+			Feed string `help:"Use extraction rules of the feed with this slug. Other flags override them."`
+			ExtractFlags
+		} `cmd:"" help:"Preview extraction of a page"`
+		Set struct {
+			Slug string `arg:"" name:"slug" help:"Feed slug."`
+			ExtractFlags
+		} `cmd:"" help:"Save extraction rules of a feed"`
+	} `cmd:"" help:"Manage article extraction rules"`
+
+	Rules struct {
+		Add struct {
+			Action string `arg:"" name:"action" help:"One of drop, tag, mark_read, rewrite, strip, skip_page." enum:"drop,tag,mark_read,rewrite,strip,skip_page"`
+			Expr   string `arg:"" name:"expr" help:"Condition over title, description, content, link and feed, e.g. 'title icontains \"sponsored\"'. Empty matches all."`
+			RuleFlags
+		} `cmd:"" help:"Add a rule"`
+		List struct {
+		} `cmd:"" help:"List rules in the order they run"`
+		Rm struct {
+			ID string `arg:"" name:"id" help:"Rule id."`
+		} `cmd:"" help:"Remove a rule"`
+		Test struct {
+			Slug string `arg:"" name:"slug" help:"Feed slug."`
+		} `cmd:"" help:"Fetch a feed and show what record rules do with it"`
+	} `cmd:"" help:"Manage rules filtering and rewriting records"`
+
+	User struct {
+		Add struct {
+			Name     string `arg:"" name:"name" help:"User name."`
+			Password string `help:"Password of the user. Users without password sign in with tokens only." env:"FEEDER_PASSWORD"`
+			Admin    bool   `help:"Allow the user to change feeds and settings."`
+		} `cmd:"" help:"Add a user"`
+		Password struct {
+			Name     string `arg:"" name:"name" help:"User name."`
+			Password string `help:"New password. The password is removed if empty." env:"FEEDER_PASSWORD"`
+		} `cmd:"" help:"Change password of a user"`
+		Fever struct {
+			Name string `arg:"" name:"name" help:"User name."`
+		} `cmd:"" help:"Make a new Fever API password of a user and print it"`
+		List struct {
+		} `cmd:"" help:"List users"`
+		Rm struct {
+			Name string `arg:"" name:"name" help:"User name."`
+		} `cmd:"" help:"Remove a user with subscriptions and read state"`
+		Token struct {
+			Name      string `arg:"" name:"name" help:"User name."`
+			Kind      string `help:"api to sign in to the API or feed for private feed URLs." enum:"api,feed" default:"api"`
+			TokenName string `name:"label" help:"Label of the token to tell it from others."`
+		} `cmd:"" help:"Make a new token of a user and print it"`
+		Tokens struct {
+			Name string `arg:"" name:"name" help:"User name."`
+		} `cmd:"" help:"List tokens of a user"`
+		Revoke struct {
+			ID string `arg:"" name:"id" help:"Token id."`
+		} `cmd:"" help:"Revoke a token"`
+		Subscribe struct {
+			Name  string   `arg:"" name:"name" help:"User name."`
+			Feeds []string `arg:"" name:"feed" help:"Slugs or URLs of feeds. New URLs are added as feeds."`
+		} `cmd:"" help:"Subscribe a user to feeds"`
+		Unsubscribe struct {
+			Name  string   `arg:"" name:"name" help:"User name."`
+			Feeds []string `arg:"" name:"feed" help:"Slugs of feeds."`
+		} `cmd:"" help:"Unsubscribe a user from feeds"`
+	} `cmd:"" help:"Manage users and their subscriptions"`
+
+	Webhook struct {
+		Add struct {
+			Url string `arg:"" name:"url" help:"URL events are posted to."`
+			WebhookFlags
+		} `cmd:"" help:"Add a webhook"`
+		List struct {
+		} `cmd:"" help:"List webhooks"`
+		Rm struct {
+			ID string `arg:"" name:"id" help:"Webhook id."`
+		} `cmd:"" help:"Remove a webhook with its delivery log"`
+		Log struct {
+			ID    string `arg:"" name:"id" help:"Webhook id."`
+			Limit int    `help:"Maximum number of attempts." default:"20"`
+		} `cmd:"" help:"Show recent delivery attempts of a webhook"`
+	} `cmd:"" help:"Manage webhooks posting events to other services"`
+
+	Blob struct {
+		Migrate struct {
+			Batch  int  `help:"Number of pages moved in one transaction." default:"100"`
+			Vacuum bool `help:"Vacuum the database after moving pages."`
+		} `cmd:"" help:"Move html of existing pages from the database to the blob store"`
+	} `cmd:"" help:"Manage the page blob store"`
+}
+
+const DATABASE_URI = "feed.db"
+
+const userAgent = "feeder/0.1 (+https://github.com/tmshv/feeder)"
+
+// maxFeedSize is the size of the largest feed fetched, in bytes.
+const maxFeedSize = 16 << 20
+
+// maxPageSize is the size of the largest page fetched, in bytes.
+const maxPageSize = 16 << 20
+
+// pageClient fetches pages of records. A page stalling the fetch would
+// hold the worker extracting it.
+var pageClient = &http.Client{Timeout: 60 * time.Second}
+
+// defaultBaseUrl is where feeds are served without --public-url.
+const defaultBaseUrl = "http://127.0.0.1:3000"
+
+// baseUrl is where feeds are served, set by --public-url.
+var baseUrl string
+
+// websubEnabled subscribes feeds to their WebSub hubs. Hubs have to reach
+// the callback, so it is set by --public-url only.
+var websubEnabled bool
+
+// canonicalizer rewrites links of records, so the same page linked
+// differently is stored once.
+var canonicalizer = utils.DefaultCanonicalizer
+
+// bus passes news of added records and extracted pages to the server.
+var bus = events.NewBus()
+
+// statusError is an unexpected status of a fetched feed or page.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", int(e))
 }
 
-func fetchFeedRecords(feed *internal.Feed) ([]internal.Record, error) {
-	parser := gofeed.NewParser()
+// errNotModified tells the feed has not changed since the last fetch.
+var errNotModified = errors.New("not modified")
+
+// fetchState keeps validators of the last fetched content of a feed and
+// links found in it, so an unchanged feed is not downloaded again.
+type fetchState struct {
+	validators conditional.Validators
+	links      websub.Links
+}
+
+// fetchFeedRecords fetches the feed and makes records of its items. Links
+// to the WebSub hub of the feed are found too. The feed is revalidated
+// with the state of the last fetch, errNotModified is returned with links
+// of the state if it has not changed. State may be nil to fetch the feed
+// anyway.
+func fetchFeedRecords(feed *internal.Feed, state *fetchState) ([]internal.Record, websub.Links, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	f, err := parser.ParseURLWithContext(feed.Url, ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.Url, nil)
 	if err != nil {
-		return nil, err
+		return nil, websub.Links{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if state != nil {
+		state.validators.Set(req)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, websub.Links{}, err
+	}
+	defer res.Body.Close()
+	if state != nil && state.validators.NotModified(res) {
+		log.Printf("Fetch %s: not modified", feed.Url)
+		return nil, state.links, errNotModified
+	}
+	if res.StatusCode != 200 {
+		return nil, websub.Links{}, statusError(res.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, websub.Links{}, err
+	}
+	if len(body) > maxFeedSize {
+		return nil, websub.Links{}, fmt.Errorf("feed is larger than %d bytes", maxFeedSize)
 	}
 
 	log.Printf("Fetch %s", feed.Url)
 
+	records, err := parseFeedRecords(feed, body)
+	if err != nil {
+		return nil, websub.Links{}, err
+	}
+	links := websub.Discover(res.Request.URL, res.Header, body)
+	if state != nil {
+		*state = fetchState{
+			validators: conditional.Of(res),
+			links:      links,
+		}
+	}
+	return records, links, nil
+}
+
+// parseFeedRecords makes records of items of the fetched or pushed feed.
+// Items without a date are published when updated. Records of items with
+// neither are left without a date, addRecords dates them when added.
+func parseFeedRecords(feed *internal.Feed, body []byte) ([]internal.Record, error) {
+	f, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
 	result := make([]internal.Record, 0)
 	for _, item := range f.Items {
 		var rec internal.Record
@@ -65,51 +314,153 @@ func fetchFeedRecords(feed *internal.Feed) ([]internal.Record, error) {
 		rec.Title = item.Title
 		rec.Description = item.Description
 		rec.Content = item.Content
-		rec.PublishedAt = *item.PublishedParsed
-		rec.Link = utils.DropUtmMarkers(item.Link)
+		switch {
+		case item.PublishedParsed != nil:
+			rec.PublishedAt = *item.PublishedParsed
+		case item.UpdatedParsed != nil:
+			rec.PublishedAt = *item.UpdatedParsed
+		}
+		rec.Link = item.Link
+		rec.LinkKey = linkKey(item.Link)
+		rec.CanonicalLink = rec.LinkKey
 
 		result = append(result, rec)
 	}
 	return result, nil
 }
 
-func runFeed(db store.Store, feed internal.Feed, news chan string) {
+// linkKey makes the key records linking to the same page share.
+func linkKey(link string) string {
+	return canonicalizer.Canonical(utils.Unwrap(link))
+}
+
+// runFeed fetches the feed every refresh period until the context is
+// done. A signal from refresh fetches the feed without waiting. Feeds
+// pushed by WebSub hubs are fetched rarely. Periods are spread by up to
+// ten seconds so feeds do not all fetch at once.
+func runFeed(ctx context.Context, db store.Store, feed internal.Feed, news chan internal.Record, refresh <-chan struct{}) {
 	log.Printf("Run feed %s (%s)", feed.Slug, feed.Slug)
+	var state fetchState
 	for {
-		records, err := fetchFeedRecords(&feed)
-		if err != nil {
+		wait := time.Duration(feed.RefreshMs+rand.Int63n(10000)) * time.Millisecond
+		start := time.Now()
+		records, links, err := fetchFeedRecords(&feed, &state)
+		metrics.FetchDuration.WithLabelValues(feed.Slug).Observe(time.Since(start).Seconds())
+		switch {
+		case errors.Is(err, errNotModified):
+			metrics.Fetches.WithLabelValues(feed.Slug, metrics.FetchNotModified).Inc()
+			wait = syncWebSub(db, feed, links, wait)
+		case err != nil:
+			metrics.Fetches.WithLabelValues(feed.Slug, metrics.FetchError).Inc()
 			log.Printf("Failed for fetch feed %s", feed.Url)
+			bus.Publish(events.Event{
+				Type:  events.FeedFailed,
+				Feed:  feed.Slug,
+				Url:   feed.Url,
+				Error: err.Error(),
+			})
+		default:
+			metrics.Fetches.WithLabelValues(feed.Slug, metrics.FetchOK).Inc()
+			wait = syncWebSub(db, feed, links, wait)
 		}
 
-		count := 0
-		for _, rec := range records {
-			added, err := db.AddRecord(rec)
+		count := addRecords(db, feed, records, news)
+
+		log.Printf("Found %d new records (%d total) in feed %s. Falling to sleep %d ms", count, len(records), feed.Slug, wait.Milliseconds())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("Stop feed %s", feed.Slug)
+			return
+		case <-refresh:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// addRecords adds new records of the feed passing its rules and sends
+// them to fetch their pages. It returns the number of added records.
+func addRecords(db store.Store, feed internal.Feed, records []internal.Record, news chan internal.Record) int {
+	ruleset := loadRules(db, feed.ID)
+	count := 0
+	for _, rec := range records {
+		if rec.PublishedAt.IsZero() {
+			// Undated items are told apart by links only.
+			found, err := db.HasRecordLink(feed.ID, rec.Link)
 			if err != nil {
-				log.Printf("Failed add record %s", rec.Link)
+				log.Printf("Failed to find record %s: %v", rec.Link, err)
+				continue
+			}
+			if found {
+				continue
+			}
+			rec.PublishedAt = time.Now()
+		}
+		if !applyRecordRules(ruleset, &rec, feed.Slug) {
+			continue
+		}
+		added, err := db.AddRecord(rec)
+		if err != nil {
+			log.Printf("Failed add record %s", rec.Link)
+			continue
+		}
+		if added > 0 {
+			count += 1
+			metrics.RecordsAdded.WithLabelValues(feed.Slug).Inc()
+			if !rec.ReadAt.IsZero() {
+				err = markRecordRead(db, rec.ID)
+				if err != nil {
+					log.Printf("Failed to mark record %s read: %v", rec.ID, err)
+				}
+			}
+			publish(db, events.Event{
+				Type:   events.RecordCreated,
+				Feed:   feed.Slug,
+				Tags:   rec.Tags,
+				Record: &rec,
+			})
+			if !rec.SkipPage {
+				news <- rec
 				continue
 			}
-			if added > 0 {
-				count += 1
-				news <- rec.Link
+
+			text := rec.Content
+			if text == "" {
+				text = rec.Description
+			}
+			err = assignStory(db, rec, text)
+			if err != nil {
+				log.Printf("Failed to find story of %s: %v", rec.Link, err)
 			}
 		}
+	}
+	return count
+}
 
-		log.Printf("Found %d new records (%d total) in feed %s. Falling to sleep %d ms", count, len(records), feed.Slug, feed.RefreshMs)
-		time.Sleep(time.Duration(feed.RefreshMs) * time.Millisecond)
+// publish tells subscribers of the bus about the event with the record of
+// the event as it is stored.
+func publish(db store.Store, e events.Event) {
+	stored, err := db.GetRecord(e.Record.ID)
+	if err == nil {
+		e.Record = &stored
+		e.Tags = stored.Tags
 	}
+	bus.Publish(e)
 }
 
-func handleRecords(db store.Store, news chan string) error {
+func handleRecords(db store.Store, news chan internal.Record) error {
 	log.Println("Wait for news to readability")
 
 	for {
-		if url, ok := <-news; ok {
-			err := handlePage(db, url)
+		if rec, ok := <-news; ok {
+			err := handlePage(db, rec)
 			if err != nil {
-				log.Printf("Failed to get content of %s", url)
+				log.Printf("Failed to get content of %s", rec.Link)
 				continue
 			}
-			log.Printf("Added content of %s", url)
+			log.Printf("Added content of %s", rec.Link)
 		} else {
 			log.Println("Chan closed")
 			return nil
@@ -117,60 +468,151 @@ func handleRecords(db store.Store, news chan string) error {
 	}
 }
 
-func handlePage(db store.Store, url string) error {
-	r := readability.New()
-	res, err := http.Get(url)
+// fetchPage downloads the page and keeps the exchanged headers, so the
+// page can be archived later. The page gets the URL it was finally fetched
+// from after redirects.
+func fetchPage(url string) (internal.Page, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		log.Printf("Failed to get content of %s", url)
-		return err
+		return internal.Page{}, err
 	}
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := pageClient.Do(req)
+	if err != nil {
+		return internal.Page{}, err
+	}
+	defer res.Body.Close()
 	if res.StatusCode != 200 {
-		log.Printf("Got not OK for %s", url)
-		return err
+		return internal.Page{}, statusError(res.StatusCode)
 	}
 
-	bodyBytes, err := ioutil.ReadAll(res.Body)
+	bodyBytes, err := io.ReadAll(io.LimitReader(res.Body, maxPageSize+1))
 	if err != nil {
-		log.Printf("Failed to read body bytes of %s: %v", url, err)
-		return err
+		return internal.Page{}, err
+	}
+	if len(bodyBytes) > maxPageSize {
+		return internal.Page{}, fmt.Errorf("page is larger than %d bytes", maxPageSize)
 	}
 
-	bodyBuf := bytes.NewBuffer(bodyBytes)
-	a, err := r.Parse(bodyBuf, url)
+	html := string(bodyBytes)
+	finalUrl := res.Request.URL.String()
+	return internal.Page{
+		Url:             finalUrl,
+		CanonicalUrl:    canonicalizer.CanonicalFromHTML(finalUrl, html),
+		Html:            html,
+		Status:          res.StatusCode,
+		RequestHeaders:  formatHeader(res.Request.Header),
+		ResponseHeaders: formatHeader(res.Header),
+	}, nil
+}
+
+// failureReason tells why extraction of a page failed, for metrics.
+func failureReason(err error) string {
+	var status statusError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &status):
+		return "status"
+	case errors.As(err, &urlErr):
+		return "network"
+	}
+	return "extract"
+}
+
+func handlePage(db store.Store, rec internal.Record) error {
+	feed, err := db.GetFeedByID(rec.FeedID)
 	if err != nil {
-		log.Printf("Failed to readability parse %s: %v", url, err)
+		metrics.ExtractionFailures.WithLabelValues("store").Inc()
+		log.Printf("Failed to get feed of %s: %v", rec.Link, err)
 		return err
 	}
 
-	htmlStr := string(bodyBytes)
+	ruleset := loadRules(db, feed.ID)
+	extractRules := feed.Extract
+	extractRules.Remove = append(extractRules.Remove, stripSelectors(ruleset, rec, feed.Slug)...)
+
+	// The link given by the feed is fetched. The canonical link is a key
+	// and may be upgraded to https the site does not serve.
+	pages, article, err := fetchArticle(rec.Link, extractRules)
 	if err != nil {
-		log.Printf("%v", err)
+		metrics.ExtractionFailures.WithLabelValues(failureReason(err)).Inc()
+		log.Printf("Failed to get content of %s: %v", rec.Link, err)
 		return err
 	}
 
-	md, err := htmlToMd(a.Content)
+	// The article is found by the URL it was redirected to, so records
+	// linking to it through different trackers share the page. The page
+	// keeps the URL it was fetched from.
+	canonical := pages[0].CanonicalUrl
+	if canonical == "" {
+		canonical = canonicalizer.Canonical(utils.Unwrap(pages[0].Url))
+	}
+	if canonical != rec.CanonicalLink {
+		err = db.UpdateRecordCanonicalLink(rec.ID, canonical)
+		if err != nil {
+			metrics.ExtractionFailures.WithLabelValues("store").Inc()
+			log.Printf("Failed to update link of %s: %v", rec.Link, err)
+			return err
+		}
+		rec.CanonicalLink = canonical
+	}
+	pages[0].CanonicalUrl = canonical
+
+	err = applyPageRules(db, ruleset, rec, feed.Slug, &article)
 	if err != nil {
-		log.Printf("Cannot create markdown of %s, %v", url, err)
+		log.Printf("Failed to apply rules to %s: %v", rec.Link, err)
+	}
+
+	for i, page := range pages {
+		if i == 0 {
+			page.Content = article.Content
+			page.Title = article.Title
+			page.PublishedAt = article.PublishedAt
+		} else {
+			// Next pages may declare the first one canonical.
+			page.CanonicalUrl = page.Url
+			page.Index = i
+		}
+		err = db.AddPage(page)
+		if err != nil {
+			metrics.ExtractionFailures.WithLabelValues("store").Inc()
+			log.Printf("Failed to add Page %s", page.Url)
+			return err
+		}
 	}
+	publish(db, events.Event{
+		Type:   events.PageExtracted,
+		Feed:   feed.Slug,
+		Tags:   rec.Tags,
+		Record: &rec,
+		Url:    canonical,
+		Title:  article.Title,
+	})
 
-	err = db.AddPage(url, htmlStr, md)
+	err = assignStory(db, rec, article.Content)
 	if err != nil {
-		log.Printf("Failed to add Page %s", url)
-		return err
+		log.Printf("Failed to find story of %s: %v", rec.Link, err)
 	}
 
 	return nil
 }
 
-func handleOldRecords(db store.Store, news chan string) error {
-	urls, err := db.FindRecordsWithNoPage()
+func formatHeader(h http.Header) string {
+	var buf strings.Builder
+	h.Write(&buf)
+	return buf.String()
+}
+
+func handleOldRecords(db store.Store, news chan internal.Record) error {
+	records, err := db.FindRecordsWithNoPage()
 	if err != nil {
-		log.Printf("Failed to find urls: %v", err)
+		log.Printf("Failed to find records: %v", err)
 		return err
 	}
 
-	for _, url := range urls {
-		news <- url
+	for _, rec := range records {
+		news <- rec
 	}
 	return nil
 }
@@ -231,6 +673,9 @@ func importOpml(db store.Store, filePath string) error {
 				slug := slugify(item.Title)
 				log.Printf("Add %s", item.XMLURL)
 				err = db.AddFeed(slug, item.XMLURL)
+				if err != nil {
+					log.Printf("Failed to add %s as %s: %v", item.XMLURL, slug, err)
+				}
 				continue
 			}
 
@@ -241,117 +686,58 @@ func importOpml(db store.Store, filePath string) error {
 	return nil
 }
 
-func htmlToMd(html string) (string, error) {
-	converter := md.NewConverter("", true, nil)
-	return converter.ConvertString(html)
-}
-
-func allToMd(db store.Store) {
-	r := readability.New()
-	pages, err := db.GetAllPages()
-	if err != nil {
-		log.Printf("Failed to all to md: %v", err)
+func search(db store.Store, query string, feedSlug string, limit int) error {
+	filter := internal.SearchFilter{
+		Limit: limit,
 	}
-
-	for _, page := range pages {
-		html := strings.NewReader(page.Html)
-		a, err := r.Parse(html, page.Url)
+	if feedSlug != "" {
+		feed, err := db.GetFeedBySlug(feedSlug)
 		if err != nil {
-			log.Printf("Readability failed to parse %s: %v", page.Url, err)
-			continue
+			return err
 		}
+		filter.FeedIDs = []string{feed.ID}
+	}
 
-		md, err := htmlToMd(a.Content)
-		if err != nil {
-			log.Printf("Markdown failed to convert from html %s: %v", page.Url, err)
-			continue
-		}
+	results, err := db.Search(query, filter)
+	if err != nil {
+		return err
+	}
 
-		err = db.UpdatePageContent(&page, md)
-		if err != nil {
-			log.Printf("Failed to update content of page %s: %v", page.Url, err)
-			continue
-		}
+	for _, res := range results {
+		snippet := strings.NewReplacer("<mark>", "\033[1m", "</mark>", "\033[0m", "\n", " ").Replace(res.Snippet)
+		fmt.Printf("%s  %s\n%s\n%s\n\n", res.PublishedAt.Format("2006-01-02"), res.Title, res.Link, snippet)
 	}
+	fmt.Printf("Found %d records\n", len(results))
+	return nil
 }
 
-func serve(db store.Store) {
-	app := fiber.New()
-
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.SendString("Hello, World!")
-	})
-
-	app.Get("/feed/:slug", func(c *fiber.Ctx) error {
-		slug := c.Params("slug")
-		feed, err := db.GetFeedBySlug(slug)
+func serve(db store.Store, runner server.Runner) {
+	if !cli.Serve.NoAuth {
+		err := bootstrapAdmin(db)
 		if err != nil {
-			return c.Status(404).JSON(&fiber.Map{
-				"error": "Feed not found",
-			})
+			log.Fatalf("Failed to add admin user: %v", err)
 		}
+	}
 
-		records, err := db.GetFeedRecords(feed.ID, true)
-		if err != nil {
-			return c.Status(404).JSON(&fiber.Map{
-				"error": "Records not found",
-			})
-		}
-
-		items := make([]*jsonfeed.Item, 0)
-		for _, rec := range records {
-			item := jsonfeed.Item{
-				ID:    rec.ID,
-				URL:   rec.Link,
-				Title: rec.Title,
-				// ContentHTML   string  `json:"content_html,omitempty"`   // content_html and content_text are each optional strings — but one or both must be present. This is the HTML or plain text of the item. Important: the only place HTML is allowed in this format is in content_html. A Twitter-like service might use content_text, while a blog might use content_html. Use whichever makes sense for your resource. (It doesn’t even have to be the same for each item in a feed.)
-				ContentText: rec.Content,
-				Summary:     rec.Description,
-				// Image         string  `json:"image,omitempty"`          // image (optional, string) is the URL of the main image for the item. This image may also appear in the content_html
-				// BannerImage   string  `json:"banner_image,omitempty"`   // banner_image (optional, string) is the URL of an image to use as a banner.
-				DatePublished: rec.PublishedAt.String(),
-				// DateModified  string  `json:"date_modified,omitempty"`  // date_modified (optional, string) specifies the modification date in RFC 3339 format.
-				// Author        *Author `json:"author,omitempty"`         // author (optional, object) has the same structure as the top-level author. If not specified in an item, then the top-level author, if present, is the author of the item.
-
-				Tags: []string{"good", "trash", "travel"},
-				// Attachments *[]Attachments `json:"attachments,omitempty"` // attachments (optional, array) lists related resources. Podcasts, for instance, would include an attachment that’s an audio or video file. An individual item may have one or more attachments.
-				// Authors  []*Author `json:"authors,omitempty"`
-				// Language string    `json:"language,omitempty"`
-			}
-			items = append(items, &item)
-		}
-
-		url := fmt.Sprintf("http://127.0.0.1:3000/feed/%s", slug)
-		f := jsonfeed.Feed{
-			Version: "https://jsonfeed.org/version/1.1",
-			Title:   feed.Slug,
-			// HomePageURL string  `json:"home_page_url,omitempty"` // home_page_url (optional but strongly recommended, string) is the URL of the resource that the feed describes. This resource should be an HTML page
-			FeedURL: url,
-			// Description string  `json:"description,omitempty"`   // description (optional, string)
-			// UserComment string  `json:"user_comment,omitempty"`  // user_comment (optional, string) is a description of the purpose of the feed. This is for the use of people looking at the raw JSON, and should be ignored by feed readers.
-			// NextURL     string  `json:"next_url,omitempty"`      // next_url (optional, string) is the URL of a feed that provides the next n items. This allows for pagination
-			// Icon        string  `json:"icon,omitempty"`          // icon (optional, string) is the URL of an image for the feed suitable to be used in a timeline. It should be square and relatively large — such as 512 x 512
-			// Favicon     string  `json:"favicon,omitempty"`       // favicon (optional, string) is the URL of an image for the feed suitable to be used in a source list. It should be square and relatively small, but not smaller than 64 x 64
-			// Author      *Author `json:"author,omitempty"`        // author (optional, object) specifies the feed author. The author object has several members. These are all optional — but if you provide an author object, then at least one is required:
-			// Expired     bool    `json:"expired,omitempty"`       // expired (optional, boolean) says whether or not the feed is finished — that is, whether or not it will ever update again.
-			Items: items,
-			// Authors  []*Author `json:"authors,omitempty"`
-			// Language string    `json:"language,omitempty"`
-		}
-		return c.JSON(f)
-	})
+	srv := server.New(db, runner, bus, baseUrl, cli.Serve.NoAuth)
 
 	log.Print("Listening :3000")
-	err := app.Listen(":3000")
+	err := srv.Listen(":3000")
 	log.Fatal(err)
 }
 
+func openStore(logger *log.Logger) (*store.SqliteStore, error) {
+	blobs, err := blob.NewFileStore(cli.Blobs)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewSqliteStore(DATABASE_URI, blobs, logger)
+}
+
 func run(logger *log.Logger) {
 	rand.Seed(time.Now().UnixNano())
 
-	DATABASE_URI := "feed.db"
-
-	db, err := store.NewSqliteStore(DATABASE_URI, logger)
+	db, err := openStore(logger)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -360,7 +746,11 @@ func run(logger *log.Logger) {
 	// err = importOpml(db, "20230426-reeder.opml")
 	// err = addFeed(db, "hacker-news", feedUrl)
 
-	go serve(db)
+	// Records added before link keys would be added again otherwise.
+	_, err = db.FillRecordLinkKeys(linkKey, 1000)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	feeds, err := db.GetFeeds()
 	if err != nil {
@@ -371,16 +761,24 @@ func run(logger *log.Logger) {
 
 	// Create a channel to communicate with the goroutine.
 	done := make(chan bool)
-	news := make(chan string, 1000)
+	news := make(chan internal.Record, 1000)
+	metrics.WatchPageQueue(func() int {
+		return len(news)
+	})
 
 	for i := 0; i < 3; i++ {
 		go handleRecords(db, news)
 	}
 	go handleOldRecords(db, news)
-	// go allToMd(db)
+
+	sched := newScheduler(db, news)
+	go serve(db, sched)
+	dispatcher := webhook.NewDispatcher(db)
+	bus.Hook(dispatcher.Enqueue)
+	go dispatcher.Run()
 
 	for _, feed := range feeds {
-		go runFeed(db, feed, news)
+		sched.Start(feed)
 	}
 
 	// Wait for an interrupt signal (SIGINT or SIGTERM).
@@ -398,9 +796,374 @@ func main() {
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
 
 	ctx := kong.Parse(&cli)
+	canonicalizer = utils.NewCanonicalizer(cli.DropParam...)
+	canonicalizer.Https = !cli.KeepHttp
+	baseUrl = strings.TrimSuffix(cli.PublicUrl, "/")
+	websubEnabled = baseUrl != ""
+	if baseUrl == "" {
+		baseUrl = defaultBaseUrl
+	}
 	switch ctx.Command() {
 	case "serve":
 		run(logger)
+	case "export warc <output>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Export.Warc
+		err = exportWarc(db, opts.Output, opts.Feed, opts.Since, opts.Until)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "reprocess":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Reprocess
+		// Next pages are rebuilt with the first ones.
+		filter := internal.PageFilter{
+			Since: opts.Since,
+			First: true,
+		}
+		if opts.Feed != "" {
+			feed, err := db.GetFeedBySlug(opts.Feed)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			filter.FeedID = feed.ID
+		}
+		err = reprocessPages(db, filter, opts.Workers, opts.Resume)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "search <query>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Search
+		err = search(db, opts.Query, opts.Feed, opts.Limit)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "saved add <slug> <query>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Saved.Add
+		err = addSavedSearch(db, opts.Slug, opts.Query, opts.Title, opts.Feed, opts.Since, opts.Until, opts.Within)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "saved list":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listSavedSearches(db)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "saved rm <slug>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.DeleteSavedSearch(cli.Saved.Rm.Slug)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "group add <name> <feed>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = addToGroup(db, cli.Group.Add.Name, cli.Group.Add.Feeds)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "group list":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listGroups(db)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "group rm <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = removeGroup(db, cli.Group.Rm.Name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "extract test <url>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Extract.Test
+		err = testExtract(db, opts.Url, opts.Feed, opts.ExtractFlags)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "extract set <slug>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = setExtractRules(db, cli.Extract.Set.Slug, cli.Extract.Set.ExtractFlags)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "rules add <action> <expr>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Rules.Add
+		err = addRule(db, opts.Action, opts.Expr, opts.RuleFlags)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "rules list":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listRules(db)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "rules rm <id>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.DeleteRule(cli.Rules.Rm.ID)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "rules test <slug>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = testRules(db, cli.Rules.Test.Slug)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user add <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = addUser(db, cli.User.Add.Name, cli.User.Add.Password, cli.User.Add.Admin)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user password <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = setUserPassword(db, cli.User.Password.Name, cli.User.Password.Password)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user fever <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = setFeverPassword(db, cli.User.Fever.Name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user list":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listUsers(db)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user rm <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = removeUser(db, cli.User.Rm.Name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user token <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.User.Token
+		err = addToken(db, opts.Name, opts.Kind, opts.TokenName)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user tokens <name>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listTokens(db, cli.User.Tokens.Name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user revoke <id>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.DeleteToken(cli.User.Revoke.ID)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user subscribe <name> <feed>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = subscribe(db, cli.User.Subscribe.Name, cli.User.Subscribe.Feeds)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "user unsubscribe <name> <feed>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = unsubscribe(db, cli.User.Unsubscribe.Name, cli.User.Unsubscribe.Feeds)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "webhook add <url>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = addWebhook(db, cli.Webhook.Add.Url, cli.Webhook.Add.WebhookFlags)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "webhook list":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listWebhooks(db)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "webhook rm <id>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.DeleteWebhook(cli.Webhook.Rm.ID)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "webhook log <id>":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		err = listWebhookDeliveries(db, cli.Webhook.Log.ID, cli.Webhook.Log.Limit)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "blob migrate":
+		db, err := openStore(logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		opts := cli.Blob.Migrate
+		n, err := db.MovePagesToBlobs(opts.Batch)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("Moved %d pages to %s", n, cli.Blobs)
+
+		if opts.Vacuum {
+			err = db.Vacuum()
+			if err != nil {
+				logger.Fatal(err)
+			}
+		}
 	case "add":
         logger.Fatal("add command not yet implemented")
 	case "import":
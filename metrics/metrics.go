@@ -0,0 +1,64 @@
+// Package metrics has Prometheus metrics of feeder: fetches of feeds,
+// extraction of pages, added records, statements run by the store and
+// requests served.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of fetches of feeds.
+const (
+	FetchOK = "ok"
+	// FetchNotModified is a fetch answered with 304 by a feed revalidated
+	// with ETag or Last-Modified.
+	FetchNotModified = "not_modified"
+	FetchError       = "error"
+)
+
+var (
+	Fetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feeder_feed_fetches_total",
+		Help: "Fetches of feeds by result: ok, not_modified or error.",
+	}, []string{"feed", "result"})
+
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "feeder_feed_fetch_duration_seconds",
+		Help:    "Time to fetch and parse feeds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"feed"})
+
+	RecordsAdded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feeder_records_added_total",
+		Help: "Records added to feeds.",
+	}, []string{"feed"})
+
+	ExtractionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feeder_extraction_failures_total",
+		Help: "Pages of records failed to be extracted by reason: status, network, extract or store.",
+	}, []string{"reason"})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "feeder_store_query_duration_seconds",
+		Help:    "Time to run statements of the store by store method.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"method"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "feeder_http_request_duration_seconds",
+		Help:    "Time to handle requests by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// WatchPageQueue exports the number of records waiting for their pages to
+// be fetched. It is called once.
+func WatchPageQueue(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "feeder_page_queue_depth",
+		Help: "Records waiting for their pages to be fetched.",
+	}, func() float64 {
+		return float64(depth())
+	})
+}
@@ -0,0 +1,3 @@
+ALTER TABLE pages DROP COLUMN response_headers;
+ALTER TABLE pages DROP COLUMN request_headers;
+ALTER TABLE pages DROP COLUMN status;
@@ -0,0 +1,3 @@
+ALTER TABLE pages ADD COLUMN status INTEGER;
+ALTER TABLE pages ADD COLUMN request_headers TEXT;
+ALTER TABLE pages ADD COLUMN response_headers TEXT;
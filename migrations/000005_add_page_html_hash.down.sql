@@ -0,0 +1 @@
+ALTER TABLE pages DROP COLUMN html_hash;
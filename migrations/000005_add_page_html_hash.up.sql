@@ -0,0 +1 @@
+ALTER TABLE pages ADD COLUMN html_hash TEXT;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS checkpoints (
+    name TEXT NOT NULL PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at DATETIME NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE pages DROP COLUMN published_at;
+ALTER TABLE pages DROP COLUMN title;
+ALTER TABLE feeds DROP COLUMN extract_rules;
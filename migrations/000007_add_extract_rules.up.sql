@@ -0,0 +1,3 @@
+ALTER TABLE feeds ADD COLUMN extract_rules TEXT;
+ALTER TABLE pages ADD COLUMN title TEXT;
+ALTER TABLE pages ADD COLUMN published_at DATETIME;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS records_search;
@@ -0,0 +1,20 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS records_search USING fts5(
+    record_id UNINDEXED,
+    feed_id UNINDEXED,
+    title,
+    description,
+    content,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO records_search(record_id, feed_id, title, description, content)
+SELECT
+    r.id,
+    r.feed_id,
+    r.title,
+    r.description,
+    COALESCE(
+        (SELECT p.content FROM pages p WHERE p.url = r.link ORDER BY p.created_at DESC LIMIT 1),
+        r.content
+    )
+FROM records r;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id TEXT NOT NULL PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    title TEXT,
+    query TEXT NOT NULL,
+    feed_ids TEXT,
+    since DATETIME,
+    until DATETIME,
+    within_ms INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS feed_groups;
+DROP TABLE IF EXISTS groups;
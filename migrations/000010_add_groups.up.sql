@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS groups (
+    id TEXT NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS feed_groups (
+    group_id TEXT NOT NULL,
+    feed_id TEXT NOT NULL,
+
+    PRIMARY KEY (group_id, feed_id),
+    FOREIGN KEY (group_id) REFERENCES groups(id),
+    FOREIGN KEY (feed_id) REFERENCES feeds(id)
+);
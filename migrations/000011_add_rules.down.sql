@@ -0,0 +1,4 @@
+ALTER TABLE records DROP COLUMN skip_page;
+ALTER TABLE records DROP COLUMN read_at;
+DROP TABLE IF EXISTS record_tags;
+DROP TABLE IF EXISTS rules;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS rules (
+    id TEXT NOT NULL PRIMARY KEY,
+    feed_id TEXT,
+    name TEXT,
+    stage TEXT NOT NULL,
+    expr TEXT NOT NULL,
+    action TEXT NOT NULL,
+    field TEXT,
+    pattern TEXT,
+    value TEXT,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+
+    FOREIGN KEY (feed_id) REFERENCES feeds(id)
+);
+
+CREATE TABLE IF NOT EXISTS record_tags (
+    record_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+
+    PRIMARY KEY (record_id, tag),
+    FOREIGN KEY (record_id) REFERENCES records(id)
+);
+
+ALTER TABLE records ADD COLUMN read_at DATETIME;
+ALTER TABLE records ADD COLUMN skip_page BOOLEAN NOT NULL DEFAULT FALSE;
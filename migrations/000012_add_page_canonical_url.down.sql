@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS pages_canonical_url;
+
+ALTER TABLE pages DROP COLUMN canonical_url;
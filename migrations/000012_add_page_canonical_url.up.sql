@@ -0,0 +1,3 @@
+ALTER TABLE pages ADD COLUMN canonical_url TEXT;
+
+CREATE INDEX IF NOT EXISTS pages_canonical_url ON pages(canonical_url);
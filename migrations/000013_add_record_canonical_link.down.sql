@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS records_canonical_link;
+
+ALTER TABLE records DROP COLUMN canonical_link;
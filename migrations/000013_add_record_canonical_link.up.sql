@@ -0,0 +1,3 @@
+ALTER TABLE records ADD COLUMN canonical_link TEXT;
+
+CREATE INDEX IF NOT EXISTS records_canonical_link ON records(canonical_link);
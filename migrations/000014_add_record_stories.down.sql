@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS records_published_at;
+DROP INDEX IF EXISTS records_story_id;
+
+ALTER TABLE records DROP COLUMN story_id;
+ALTER TABLE records DROP COLUMN simhash;
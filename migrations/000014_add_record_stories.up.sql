@@ -0,0 +1,5 @@
+ALTER TABLE records ADD COLUMN simhash INTEGER;
+ALTER TABLE records ADD COLUMN story_id TEXT;
+
+CREATE INDEX IF NOT EXISTS records_story_id ON records(story_id);
+CREATE INDEX IF NOT EXISTS records_published_at ON records(published_at);
@@ -0,0 +1,2 @@
+ALTER TABLE records DROP COLUMN archived_at;
+ALTER TABLE records DROP COLUMN starred_at;
@@ -0,0 +1,2 @@
+ALTER TABLE records ADD COLUMN starred_at DATETIME;
+ALTER TABLE records ADD COLUMN archived_at DATETIME;
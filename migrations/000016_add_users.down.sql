@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_record_state;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    password_hash TEXT,
+    admin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+    id TEXT NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    name TEXT,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME,
+
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    user_id TEXT NOT NULL,
+    feed_id TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (user_id, feed_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (feed_id) REFERENCES feeds(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_record_state (
+    user_id TEXT NOT NULL,
+    record_id TEXT NOT NULL,
+    read_at DATETIME,
+    starred_at DATETIME,
+    archived_at DATETIME,
+
+    PRIMARY KEY (user_id, record_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (record_id) REFERENCES records(id)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS records_num;
+
+ALTER TABLE records DROP COLUMN num;
@@ -0,0 +1,5 @@
+ALTER TABLE records ADD COLUMN num INTEGER;
+
+UPDATE records SET num = rowid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS records_num ON records(num);
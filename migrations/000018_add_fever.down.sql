@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS groups_num;
+DROP INDEX IF EXISTS feeds_num;
+DROP INDEX IF EXISTS users_fever_key;
+
+ALTER TABLE groups DROP COLUMN num;
+ALTER TABLE feeds DROP COLUMN num;
+ALTER TABLE users DROP COLUMN fever_key;
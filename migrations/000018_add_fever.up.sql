@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN fever_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_fever_key ON users(fever_key);
+
+ALTER TABLE feeds ADD COLUMN num INTEGER;
+
+UPDATE feeds SET num = rowid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS feeds_num ON feeds(num);
+
+ALTER TABLE groups ADD COLUMN num INTEGER;
+
+UPDATE groups SET num = rowid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS groups_num ON groups(num);
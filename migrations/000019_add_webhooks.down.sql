@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS webhook_deliveries_webhook_id;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
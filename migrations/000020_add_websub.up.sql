@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS websub_subscriptions (
+    feed_id TEXT NOT NULL PRIMARY KEY,
+    hub TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    state TEXT NOT NULL,
+    lease_seconds INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME,
+    error TEXT,
+    updated_at DATETIME NOT NULL,
+
+    FOREIGN KEY (feed_id) REFERENCES feeds(id)
+);
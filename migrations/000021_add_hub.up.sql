@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS hub_subscriptions (
+    topic TEXT NOT NULL,
+    callback TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    lease_seconds INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (topic, callback)
+);
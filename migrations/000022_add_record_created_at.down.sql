@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS records_feed_created_at;
+
+ALTER TABLE records DROP COLUMN created_at;
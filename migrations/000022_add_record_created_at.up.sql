@@ -0,0 +1,5 @@
+ALTER TABLE records ADD COLUMN created_at DATETIME;
+
+UPDATE records SET created_at = published_at;
+
+CREATE INDEX IF NOT EXISTS records_feed_created_at ON records(feed_id, created_at);
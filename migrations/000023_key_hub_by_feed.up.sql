@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS hub_subscriptions;
+CREATE TABLE IF NOT EXISTS hub_subscriptions (
+    feed TEXT NOT NULL,
+    format TEXT NOT NULL DEFAULT '',
+    callback TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    lease_seconds INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (feed, format, callback)
+);
+
+DELETE FROM checkpoints WHERE name LIKE 'hub:%';
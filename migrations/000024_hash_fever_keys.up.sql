@@ -0,0 +1 @@
+UPDATE users SET fever_key = NULL;
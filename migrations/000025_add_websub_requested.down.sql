@@ -0,0 +1 @@
+ALTER TABLE websub_subscriptions DROP COLUMN requested;
@@ -0,0 +1 @@
+ALTER TABLE websub_subscriptions ADD COLUMN requested TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS records_link_key;
+
+ALTER TABLE records DROP COLUMN link_key;
@@ -0,0 +1,3 @@
+ALTER TABLE records ADD COLUMN link_key TEXT;
+
+CREATE INDEX IF NOT EXISTS records_link_key ON records(link_key, published_at);
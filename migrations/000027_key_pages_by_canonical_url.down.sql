@@ -0,0 +1 @@
+UPDATE pages SET canonical_url = NULL WHERE canonical_url = url;
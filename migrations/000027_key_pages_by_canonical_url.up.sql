@@ -0,0 +1 @@
+UPDATE pages SET canonical_url = url WHERE canonical_url IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS webhook_outbox_next_attempt_at;
+DROP TABLE IF EXISTS webhook_outbox;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    webhook_id TEXT NOT NULL,
+    delivery_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_next_attempt_at ON webhook_outbox(next_attempt_at);
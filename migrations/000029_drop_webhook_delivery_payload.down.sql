@@ -0,0 +1 @@
+ALTER TABLE webhook_deliveries ADD COLUMN payload TEXT NOT NULL DEFAULT '';
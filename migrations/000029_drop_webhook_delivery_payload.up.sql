@@ -0,0 +1 @@
+ALTER TABLE webhook_deliveries DROP COLUMN payload;
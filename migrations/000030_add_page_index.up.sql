@@ -0,0 +1,8 @@
+ALTER TABLE pages ADD COLUMN page_index INTEGER NOT NULL DEFAULT 0;
+
+-- Next pages of multi-page articles were stored under their own urls,
+-- which no record links to.
+UPDATE pages SET page_index = 1
+WHERE NOT EXISTS (
+    SELECT 1 FROM records r WHERE COALESCE(r.canonical_link, r.link) = pages.canonical_url
+);
@@ -0,0 +1,364 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"time"
+)
+
+const (
+	FormatJSON = "json"
+	FormatRSS  = "rss"
+	FormatAtom = "atom"
+)
+
+// Feed is a generated feed independent of the output format.
+type Feed struct {
+	Title       string
+	Description string
+	HomeUrl     string
+	FeedUrl     string
+	// SelfUrl is the URL the feed is served at, FeedUrl if empty. It is
+	// the topic of the feed for WebSub subscribers.
+	SelfUrl string
+	// HubUrl is the WebSub hub pushing updates of the feed.
+	HubUrl string
+	Items  []Item
+}
+
+func (f *Feed) self() string {
+	if f.SelfUrl != "" {
+		return f.SelfUrl
+	}
+	return f.FeedUrl
+}
+
+type Item struct {
+	ID          string
+	Url         string
+	Title       string
+	Summary     string
+	ContentText string
+	ContentHtml string
+	PublishedAt time.Time
+	Tags        []string
+	// Source is the feed the item came from in aggregated feeds.
+	Source *Source
+	// AlsoIn are other feeds telling the same story in aggregated feeds.
+	AlsoIn []Source
+}
+
+type Source struct {
+	Title   string
+	Url     string
+	FeedUrl string
+}
+
+// ContentType returns the MIME type of the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatRSS:
+		return "application/rss+xml; charset=utf-8"
+	case FormatAtom:
+		return "application/atom+xml; charset=utf-8"
+	default:
+		return "application/feed+json; charset=utf-8"
+	}
+}
+
+// Render writes the feed in the format. Unknown formats fall back to JSON Feed.
+func Render(f *Feed, format string) ([]byte, error) {
+	switch format {
+	case FormatRSS:
+		return RSS(f)
+	case FormatAtom:
+		return Atom(f)
+	default:
+		return JSON(f)
+	}
+}
+
+type jsonFeed struct {
+	Version     string      `json:"version"`
+	Title       string      `json:"title"`
+	HomePageURL string      `json:"home_page_url,omitempty"`
+	FeedURL     string      `json:"feed_url,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Hubs        []jsonHub   `json:"hubs,omitempty"`
+	Items       []*jsonItem `json:"items"`
+}
+
+type jsonHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url,omitempty"`
+	Title         string       `json:"title,omitempty"`
+	ContentHTML   string       `json:"content_html,omitempty"`
+	ContentText   string       `json:"content_text,omitempty"`
+	Summary       string       `json:"summary,omitempty"`
+	DatePublished string       `json:"date_published,omitempty"`
+	Tags          []string     `json:"tags,omitempty"`
+	Source        *jsonSource  `json:"_source,omitempty"`
+	AlsoIn        []jsonSource `json:"_also_in,omitempty"`
+}
+
+// jsonSource is a JSON Feed extension attributing an item to its feed. The
+// same object lists other feeds of the story in _also_in.
+type jsonSource struct {
+	Title   string `json:"title"`
+	URL     string `json:"url,omitempty"`
+	FeedURL string `json:"feed_url,omitempty"`
+}
+
+// JSON writes the feed as JSON Feed 1.1 (https://jsonfeed.org/version/1.1).
+func JSON(f *Feed) ([]byte, error) {
+	out := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeUrl,
+		FeedURL:     f.self(),
+		Description: f.Description,
+		Items:       make([]*jsonItem, 0, len(f.Items)),
+	}
+	if f.HubUrl != "" {
+		out.Hubs = []jsonHub{{Type: "WebSub", URL: f.HubUrl}}
+	}
+	for _, item := range f.Items {
+		i := jsonItem{
+			ID:          item.ID,
+			URL:         item.Url,
+			Title:       item.Title,
+			ContentHTML: item.ContentHtml,
+			ContentText: item.ContentText,
+			Summary:     item.Summary,
+			Tags:        item.Tags,
+		}
+		if !item.PublishedAt.IsZero() {
+			i.DatePublished = item.PublishedAt.Format(time.RFC3339)
+		}
+		if item.Source != nil {
+			i.Source = &jsonSource{
+				Title:   item.Source.Title,
+				URL:     item.Source.Url,
+				FeedURL: item.Source.FeedUrl,
+			}
+		}
+		for _, source := range item.AlsoIn {
+			i.AlsoIn = append(i.AlsoIn, jsonSource{
+				Title:   source.Title,
+				URL:     source.Url,
+				FeedURL: source.FeedUrl,
+			})
+		}
+		out.Items = append(out.Items, &i)
+	}
+	return json.Marshal(out)
+}
+
+type rss struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	XmlnsAtom string     `xml:"xmlns:atom,attr,omitempty"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link"`
+	Description string     `xml:"description"`
+	AtomLinks   []atomLink `xml:"atom:link"`
+	Items       []rssItem  `xml:"item"`
+}
+
+type rssGuid struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string     `xml:"title,omitempty"`
+	Link        string     `xml:"link,omitempty"`
+	Guid        rssGuid    `xml:"guid"`
+	Description string     `xml:"description,omitempty"`
+	PubDate     string     `xml:"pubDate,omitempty"`
+	Categories  []string   `xml:"category"`
+	Source      *rssSource `xml:"source,omitempty"`
+}
+
+type rssSource struct {
+	Url   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+// RSS writes the feed as RSS 2.0.
+func RSS(f *Feed) ([]byte, error) {
+	link := f.HomeUrl
+	if link == "" {
+		link = f.FeedUrl
+	}
+	out := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        link,
+			Description: f.Description,
+			Items:       make([]rssItem, 0, len(f.Items)),
+		},
+	}
+	if f.HubUrl != "" {
+		out.XmlnsAtom = atomNamespace
+		out.Channel.AtomLinks = []atomLink{
+			{Rel: "hub", Href: f.HubUrl},
+			{Rel: "self", Href: f.self(), Type: "application/rss+xml"},
+		}
+	}
+	for _, item := range f.Items {
+		description := item.ContentHtml
+		if description == "" {
+			description = item.Summary
+		}
+		i := rssItem{
+			Title:       item.Title,
+			Link:        item.Url,
+			Guid:        rssGuid{IsPermaLink: "false", Value: item.ID},
+			Description: description,
+			Categories:  item.Tags,
+		}
+		if !item.PublishedAt.IsZero() {
+			i.PubDate = item.PublishedAt.Format(time.RFC1123Z)
+		}
+		if item.Source != nil {
+			i.Source = &rssSource{
+				Url:   item.Source.FeedUrl,
+				Title: item.Source.Title,
+			}
+		}
+		out.Channel.Items = append(out.Channel.Items, i)
+	}
+
+	data, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomSource struct {
+	Title string     `xml:"title"`
+	Links []atomLink `xml:"link"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Source     *atomSource    `xml:"source,omitempty"`
+}
+
+// Atom writes the feed as Atom 1.0 (RFC 4287). Feed and entries are
+// updated when the newest entry is published.
+func Atom(f *Feed) ([]byte, error) {
+	updated := time.Time{}
+	for _, item := range f.Items {
+		if item.PublishedAt.After(updated) {
+			updated = item.PublishedAt
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	out := atomFeed{
+		Xmlns:   atomNamespace,
+		ID:      f.FeedUrl,
+		Title:   f.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: f.self(), Type: "application/atom+xml"},
+		},
+		Entries: make([]atomEntry, 0, len(f.Items)),
+	}
+	if f.HomeUrl != "" {
+		out.Links = append(out.Links, atomLink{Rel: "alternate", Href: f.HomeUrl})
+	}
+	if f.HubUrl != "" {
+		out.Links = append(out.Links, atomLink{Rel: "hub", Href: f.HubUrl})
+	}
+
+	for _, item := range f.Items {
+		published := item.PublishedAt
+		if published.IsZero() {
+			published = updated
+		}
+		e := atomEntry{
+			ID:        "urn:feeder:" + item.ID,
+			Title:     item.Title,
+			Updated:   published.UTC().Format(time.RFC3339),
+			Published: published.UTC().Format(time.RFC3339),
+		}
+		if item.Url != "" {
+			e.Links = []atomLink{{Rel: "alternate", Href: item.Url}}
+		}
+		if item.Summary != "" {
+			e.Summary = &atomText{Type: "html", Value: item.Summary}
+		}
+		switch {
+		case item.ContentHtml != "":
+			e.Content = &atomText{Type: "html", Value: item.ContentHtml}
+		case item.ContentText != "":
+			e.Content = &atomText{Type: "text", Value: item.ContentText}
+		}
+		for _, tag := range item.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: tag})
+		}
+		if item.Source != nil {
+			e.Source = &atomSource{
+				Title: item.Source.Title,
+				Links: []atomLink{{Rel: "self", Href: item.Source.FeedUrl}},
+			}
+		}
+		out.Entries = append(out.Entries, e)
+	}
+
+	data, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
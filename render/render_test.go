@@ -0,0 +1,164 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+var feed = Feed{
+	Title:   "Test",
+	FeedUrl: "http://127.0.0.1:3000/feed/test",
+	Items: []Item{
+		{
+			ID:          "1",
+			Url:         "https://example.com/a",
+			Title:       "A & B",
+			Summary:     "Summary",
+			ContentHtml: "<p>Content</p>",
+			PublishedAt: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+			Tags:        []string{"news"},
+			Source: &Source{
+				Title:   "example",
+				FeedUrl: "https://example.com/rss",
+			},
+			AlsoIn: []Source{
+				{Title: "other", FeedUrl: "https://example.org/rss"},
+			},
+		},
+	},
+}
+
+func TestJSON(t *testing.T) {
+	data, err := JSON(&feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]any
+	err = json.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["version"] != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("Wrong version %v", out["version"])
+	}
+	item := out["items"].([]any)[0].(map[string]any)
+	if item["date_published"] != "2023-05-01T10:00:00Z" {
+		t.Errorf("Date is not RFC 3339: %v", item["date_published"])
+	}
+	source, ok := item["_source"].(map[string]any)
+	if !ok || source["title"] != "example" {
+		t.Errorf("Wrong source %v", item["_source"])
+	}
+	alsoIn, ok := item["_also_in"].([]any)
+	if !ok || len(alsoIn) != 1 {
+		t.Errorf("Wrong also in %v", item["_also_in"])
+	}
+}
+
+func TestRSS(t *testing.T) {
+	data, err := RSS(&feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out rss
+	err = xml.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Channel.Items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(out.Channel.Items))
+	}
+	item := out.Channel.Items[0]
+	if item.Title != "A & B" {
+		t.Errorf("Wrong title %q", item.Title)
+	}
+	if item.Description != "<p>Content</p>" {
+		t.Errorf("Wrong description %q", item.Description)
+	}
+	if item.Source == nil || item.Source.Url != "https://example.com/rss" {
+		t.Errorf("Wrong source %v", item.Source)
+	}
+	if !strings.Contains(string(data), "<pubDate>Mon, 01 May 2023 10:00:00 +0000</pubDate>") {
+		t.Errorf("No pubDate in %s", data)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	data, err := Atom(&feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out atomFeed
+	err = xml.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != feed.FeedUrl || out.Updated != "2023-05-01T10:00:00Z" {
+		t.Errorf("Wrong feed id %q or updated %q", out.ID, out.Updated)
+	}
+	if len(out.Entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(out.Entries))
+	}
+	entry := out.Entries[0]
+	if entry.Title != "A & B" || entry.ID != "urn:feeder:1" {
+		t.Errorf("Wrong entry %q %q", entry.ID, entry.Title)
+	}
+	if entry.Content == nil || entry.Content.Type != "html" || entry.Content.Value != "<p>Content</p>" {
+		t.Errorf("Wrong content %v", entry.Content)
+	}
+	if len(entry.Categories) != 1 || entry.Categories[0].Term != "news" {
+		t.Errorf("Wrong categories %v", entry.Categories)
+	}
+}
+
+func TestHubLinks(t *testing.T) {
+	f := feed
+	f.HubUrl = "http://127.0.0.1:3000/websub/hub"
+	f.SelfUrl = "http://127.0.0.1:3000/feed/test?format=rss"
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatJSON, []string{
+			`"hubs":[{"type":"WebSub","url":"http://127.0.0.1:3000/websub/hub"}]`,
+			`"feed_url":"http://127.0.0.1:3000/feed/test?format=rss"`,
+		}},
+		{FormatRSS, []string{
+			`xmlns:atom="http://www.w3.org/2005/Atom"`,
+			`<atom:link rel="hub" href="http://127.0.0.1:3000/websub/hub"></atom:link>`,
+			`<atom:link rel="self" href="http://127.0.0.1:3000/feed/test?format=rss" type="application/rss+xml"></atom:link>`,
+		}},
+		{FormatAtom, []string{
+			`<link rel="hub" href="http://127.0.0.1:3000/websub/hub"></link>`,
+			`<link rel="self" href="http://127.0.0.1:3000/feed/test?format=rss" type="application/atom+xml"></link>`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := Render(&f, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("No %s in %s", want, data)
+				}
+			}
+		})
+	}
+
+	data, err := RSS(&feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "atom:link") {
+		t.Errorf("Links to no hub in %s", data)
+	}
+}
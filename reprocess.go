@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmshv/feeder/extract"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/rules"
+	"github.com/tmshv/feeder/store"
+)
+
+// reprocessCheckpoint names the cursor of runs over pages of the filter.
+// Runs over other feeds or dates do not resume each other.
+func reprocessCheckpoint(filter internal.PageFilter) string {
+	return fmt.Sprintf("reprocess:%s:%s:%s", filter.FeedID, checkpointTime(filter.Since), checkpointTime(filter.Until))
+}
+
+func checkpointTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// reprocessPages runs extraction again over stored pages. Pages are handled
+// by batches and the cursor of a batch is saved only after every page of it
+// is done, so an interrupted run can be resumed without gaps.
+func reprocessPages(db store.Store, filter internal.PageFilter, workers int, resume bool) error {
+	checkpoint := reprocessCheckpoint(filter)
+	var after int64
+	if resume {
+		value, err := db.GetCheckpoint(checkpoint)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			after, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			log.Printf("Resume reprocessing after page #%d", after)
+		}
+	}
+
+	total, err := db.CountPages(filter)
+	if err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	log.Printf("Reprocess %d pages with %d workers", total, workers)
+
+	var processed, failed int64
+	pages := make(chan internal.Page)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		go func() {
+			for page := range pages {
+				err := reprocessPage(db, &page)
+				if err != nil {
+					log.Printf("Failed to reprocess %s: %v", page.Url, err)
+					atomic.AddInt64(&failed, 1)
+				}
+				atomic.AddInt64(&processed, 1)
+				wg.Done()
+			}
+		}()
+	}
+	defer close(pages)
+
+	const batchSize = 100
+	start := time.Now()
+	it := db.IteratePages(filter, after)
+	n := 0
+	for it.Next() {
+		wg.Add(1)
+		pages <- it.Page()
+		n += 1
+		if n%batchSize != 0 {
+			continue
+		}
+
+		wg.Wait()
+		err := db.SetCheckpoint(checkpoint, strconv.FormatInt(it.Cursor(), 10))
+		if err != nil {
+			return err
+		}
+		log.Printf("Reprocessed %d/%d pages (%d failed) in %s", atomic.LoadInt64(&processed), total, atomic.LoadInt64(&failed), time.Since(start).Round(time.Second))
+	}
+	wg.Wait()
+	if it.Err() != nil {
+		return it.Err()
+	}
+
+	err = db.SetCheckpoint(checkpoint, strconv.FormatInt(it.Cursor(), 10))
+	if err != nil {
+		return err
+	}
+	log.Printf("Reprocessed %d pages (%d failed) in %s", processed, failed, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// reprocessPage extracts the article of the page again the way it was
+// extracted when fetched, with the extract rules of the feed and page stage
+// rules. Records are tagged by the rules but not marked read again, as
+// readers may have read them since.
+func reprocessPage(db store.Store, page *internal.Page) error {
+	rec, err := db.FindRecordByPageUrl(page.CanonicalUrl)
+	found := err == nil
+	var extractRules internal.ExtractRules
+	var ruleset []*rules.Rule
+	if found {
+		feed, err := db.GetFeedByID(rec.FeedID)
+		if err != nil {
+			return err
+		}
+		ruleset = loadRules(db, feed.ID)
+		extractRules = feed.Extract
+		extractRules.Remove = append(extractRules.Remove, stripSelectors(ruleset, rec, feed.Slug)...)
+	}
+
+	// Next pages of the article are stored as pages of their own, so the
+	// whole article is rebuilt without going to the network.
+	load := func(u string) (string, error) {
+		if u == page.Url {
+			return page.Html, nil
+		}
+		next, err := db.GetPage(u)
+		if err != nil {
+			return "", err
+		}
+		return next.Html, nil
+	}
+	article, _, err := extract.Follow(page.Url, extractRules, load)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		out := rewritePage(ruleset, rec, rec.FeedSlug, &article)
+		err = db.AddRecordTags(rec.ID, out.Tags)
+		if err != nil {
+			return err
+		}
+	}
+	return db.UpdatePageArticle(page, article.Title, article.Content)
+}
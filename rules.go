@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tmshv/feeder/extract"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/rules"
+	"github.com/tmshv/feeder/store"
+)
+
+type RuleFlags struct {
+	Feed     string `help:"Apply the rule only to the feed with this slug. Rules are global otherwise."`
+	Name     string `help:"Name of the rule."`
+	Stage    string `help:"When the rule runs: record (before the record is added) or page (when its page is fetched)." enum:"record,page" default:"record"`
+	Field    string `help:"Field changed by rewrite."`
+	Pattern  string `help:"Regexp replaced by rewrite."`
+	Value    string `help:"Tag to add, replacement of rewrite or comma separated CSS selectors to strip."`
+	Position int    `help:"Rules run in ascending position."`
+}
+
+// loadRules compiles rules applied to the feed. Broken rules are logged and
+// skipped.
+func loadRules(db store.Store, feedID string) []*rules.Rule {
+	list, err := db.GetRules(feedID)
+	if err != nil {
+		log.Printf("Failed to get rules: %v", err)
+		return nil
+	}
+	compiled, err := rules.CompileAll(list)
+	if err != nil {
+		log.Printf("Failed to compile rules: %v", err)
+	}
+	return compiled
+}
+
+// applyRecordRules runs record stage rules against the record. It returns
+// false if the record should be dropped. A record marked read has to be
+// marked for subscribers with markRecordRead once it is added.
+func applyRecordRules(list []*rules.Rule, rec *internal.Record, feedSlug string) bool {
+	env := rules.RecordEnv(rec, feedSlug)
+	out := rules.Apply(list, internal.RuleStageRecord, env)
+	if out.Drop {
+		return false
+	}
+	env.Update(rec)
+	rec.Tags = out.Tags
+	rec.SkipPage = out.SkipPage
+	if out.MarkRead {
+		rec.ReadAt = time.Now()
+	}
+	return true
+}
+
+// stripSelectors collects selectors of matched strip rules. They are
+// evaluated against the record as the page is not extracted yet.
+func stripSelectors(list []*rules.Rule, rec internal.Record, feedSlug string) []string {
+	out := rules.Apply(list, internal.RuleStagePage, rules.RecordEnv(&rec, feedSlug))
+	return out.Strip
+}
+
+// rewritePage runs page stage rules against the record with the extracted
+// article. Rewrites of title and content change the article.
+func rewritePage(list []*rules.Rule, rec internal.Record, feedSlug string, article *extract.Result) rules.Outcome {
+	if article.Title != "" {
+		rec.Title = article.Title
+	}
+	rec.Content = article.Content
+	env := rules.RecordEnv(&rec, feedSlug)
+	out := rules.Apply(list, internal.RuleStagePage, env)
+	if env["title"] != rec.Title {
+		article.Title = env["title"]
+	}
+	article.Content = env["content"]
+	return out
+}
+
+// applyPageRules rewrites the extracted article with page stage rules, then
+// tags the record or marks it read.
+func applyPageRules(db store.Store, list []*rules.Rule, rec internal.Record, feedSlug string, article *extract.Result) error {
+	out := rewritePage(list, rec, feedSlug, article)
+	err := db.AddRecordTags(rec.ID, out.Tags)
+	if err != nil {
+		return err
+	}
+	if out.MarkRead {
+		return markRecordRead(db, rec.ID)
+	}
+	return nil
+}
+
+// markRecordRead marks the record read by a rule. The record is marked for
+// subscribers of its feed and for anonymous readers of a server without
+// authentication.
+func markRecordRead(db store.Store, recordID string) error {
+	err := db.SetRecordRead(recordID, true)
+	if err != nil {
+		return err
+	}
+	return db.MarkSubscribersRead(recordID)
+}
+
+func addRule(db store.Store, action string, expr string, flags RuleFlags) error {
+	rule := internal.Rule{
+		Name:     flags.Name,
+		Stage:    flags.Stage,
+		Expr:     expr,
+		Action:   action,
+		Field:    flags.Field,
+		Pattern:  flags.Pattern,
+		Value:    flags.Value,
+		Position: flags.Position,
+	}
+	if flags.Feed != "" {
+		feed, err := db.GetFeedBySlug(flags.Feed)
+		if err != nil {
+			return err
+		}
+		rule.FeedID = feed.ID
+	}
+	_, err := rules.Compile(rule)
+	if err != nil {
+		return err
+	}
+
+	rule, err = db.AddRule(rule)
+	if err != nil {
+		return err
+	}
+	fmt.Println(rule.ID)
+	return nil
+}
+
+func listRules(db store.Store) error {
+	list, err := db.GetRules("")
+	if err != nil {
+		return err
+	}
+	feeds, err := db.GetFeeds()
+	if err != nil {
+		return err
+	}
+	slugs := map[string]string{}
+	for _, feed := range feeds {
+		slugs[feed.ID] = feed.Slug
+	}
+
+	for _, rule := range list {
+		scope := "*"
+		if rule.FeedID != "" {
+			scope = slugs[rule.FeedID]
+		}
+		action := rule.Action
+		switch rule.Action {
+		case internal.RuleActionRewrite:
+			action = fmt.Sprintf("rewrite %s s/%s/%s/", rule.Field, rule.Pattern, rule.Value)
+		case internal.RuleActionTag, internal.RuleActionStrip:
+			action = fmt.Sprintf("%s %s", rule.Action, rule.Value)
+		}
+		fmt.Printf("%s\t%d\t%s\t%s\t%s\t%s\t%s\n", rule.ID, rule.Position, scope, rule.Stage, rule.Name, action, rule.Expr)
+	}
+	return nil
+}
+
+// testRules fetches the feed and prints what record rules would do with
+// its records. Nothing is stored.
+func testRules(db store.Store, slug string) error {
+	feed, err := db.GetFeedBySlug(slug)
+	if err != nil {
+		return err
+	}
+	list, err := db.GetRules(feed.ID)
+	if err != nil {
+		return err
+	}
+	compiled, err := rules.CompileAll(list)
+	if err != nil {
+		return err
+	}
+
+	records, _, err := fetchFeedRecords(&feed, nil)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		title := rec.Title
+		if !applyRecordRules(compiled, &rec, feed.Slug) {
+			fmt.Printf("DROP\t%s\n", title)
+			continue
+		}
+
+		flags := []string{}
+		if rec.SkipPage {
+			flags = append(flags, "skip-page")
+		}
+		if !rec.ReadAt.IsZero() {
+			flags = append(flags, "read")
+		}
+		for _, tag := range rec.Tags {
+			flags = append(flags, "#"+tag)
+		}
+		fmt.Printf("KEEP\t%s\t%s\n", rec.Title, strings.Join(flags, " "))
+	}
+	return nil
+}
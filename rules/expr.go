@@ -0,0 +1,272 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Fields that expressions may refer to.
+var Fields = []string{"title", "description", "content", "link", "feed"}
+
+// Env holds record fields an expression is evaluated against.
+type Env map[string]string
+
+// Expr is a parsed boolean expression over record fields:
+//
+//	title contains "sponsored" and not (link matches "^https://example\.com/jobs/")
+//
+// Operators are ==, !=, contains and icontains (case-insensitive),
+// startswith, endswith and matches (Go regexp). Conditions are combined with
+// and, or, not and parentheses.
+type Expr interface {
+	Eval(Env) bool
+}
+
+type andExpr struct{ left, right Expr }
+type orExpr struct{ left, right Expr }
+type notExpr struct{ expr Expr }
+type boolExpr struct{ value bool }
+
+type cmpExpr struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (e andExpr) Eval(env Env) bool  { return e.left.Eval(env) && e.right.Eval(env) }
+func (e orExpr) Eval(env Env) bool   { return e.left.Eval(env) || e.right.Eval(env) }
+func (e notExpr) Eval(env Env) bool  { return !e.expr.Eval(env) }
+func (e boolExpr) Eval(env Env) bool { return e.value }
+
+func (e cmpExpr) Eval(env Env) bool {
+	v := env[e.field]
+	switch e.op {
+	case "==":
+		return v == e.value
+	case "!=":
+		return v != e.value
+	case "contains":
+		return strings.Contains(v, e.value)
+	case "icontains":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(e.value))
+	case "startswith":
+		return strings.HasPrefix(v, e.value)
+	case "endswith":
+		return strings.HasSuffix(v, e.value)
+	case "matches":
+		return e.re.MatchString(v)
+	}
+	return false
+}
+
+var operators = map[string]bool{
+	"==":         true,
+	"!=":         true,
+	"contains":   true,
+	"icontains":  true,
+	"startswith": true,
+	"endswith":   true,
+	"matches":    true,
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func tokenize(src string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '=' || c == '!':
+			if i+1 >= len(src) || src[i+1] != '=' {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOp, src[i : i+2], i})
+			i += 2
+		case c == '"' || c == '\'':
+			start := i
+			var buf strings.Builder
+			i++
+			for i < len(src) && rune(src[i]) != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				buf.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokenString, buf.String(), start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, strings.ToLower(src[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenWord && p.peek().value == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenWord && p.peek().value == "and" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.peek().kind == tokenWord && p.peek().value == "not" {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRParen {
+			return nil, fmt.Errorf("missing ) for ( at %d", t.pos)
+		}
+		return expr, nil
+	case tokenWord:
+		if t.value == "true" || t.value == "false" {
+			return boolExpr{t.value == "true"}, nil
+		}
+		if !isField(t.value) {
+			return nil, fmt.Errorf("unknown field %q at %d", t.value, t.pos)
+		}
+		op := p.next()
+		if (op.kind != tokenOp && op.kind != tokenWord) || !operators[op.value] {
+			return nil, fmt.Errorf("expected operator at %d", op.pos)
+		}
+		value := p.next()
+		if value.kind != tokenString {
+			return nil, fmt.Errorf("expected string at %d", value.pos)
+		}
+		cmp := cmpExpr{field: t.value, op: op.value, value: value.value}
+		if op.value == "matches" {
+			re, err := regexp.Compile(value.value)
+			if err != nil {
+				return nil, fmt.Errorf("bad regexp at %d: %w", value.pos, err)
+			}
+			cmp.re = re
+		}
+		return cmp, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+}
+
+func isField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses the expression. An empty expression matches everything.
+func Parse(src string) (Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return boolExpr{true}, nil
+	}
+
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+	return expr, nil
+}
@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+// Outcome collects what matched rules ask to do with a record.
+type Outcome struct {
+	Drop     bool
+	SkipPage bool
+	MarkRead bool
+	Tags     []string
+	Strip    []string
+}
+
+type Rule struct {
+	internal.Rule
+	expr    Expr
+	pattern *regexp.Regexp
+}
+
+var stageActions = map[string][]string{
+	internal.RuleStageRecord: {
+		internal.RuleActionDrop,
+		internal.RuleActionTag,
+		internal.RuleActionMarkRead,
+		internal.RuleActionRewrite,
+		internal.RuleActionSkipPage,
+	},
+	internal.RuleStagePage: {
+		internal.RuleActionTag,
+		internal.RuleActionMarkRead,
+		internal.RuleActionRewrite,
+		internal.RuleActionStrip,
+	},
+}
+
+// Compile checks the rule and prepares it for evaluation.
+func Compile(r internal.Rule) (*Rule, error) {
+	actions, ok := stageActions[r.Stage]
+	if !ok {
+		return nil, fmt.Errorf("unknown stage %q", r.Stage)
+	}
+	allowed := false
+	for _, a := range actions {
+		allowed = allowed || a == r.Action
+	}
+	if !allowed {
+		return nil, fmt.Errorf("action %q is not allowed in %s stage", r.Action, r.Stage)
+	}
+
+	expr, err := Parse(r.Expr)
+	if err != nil {
+		return nil, err
+	}
+	rule := Rule{Rule: r, expr: expr}
+
+	switch r.Action {
+	case internal.RuleActionTag, internal.RuleActionStrip:
+		if r.Value == "" {
+			return nil, fmt.Errorf("%s needs a value", r.Action)
+		}
+	case internal.RuleActionRewrite:
+		if !isField(r.Field) {
+			return nil, fmt.Errorf("unknown field %q", r.Field)
+		}
+		rule.pattern, err = regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &rule, nil
+}
+
+// CompileAll compiles rules skipping broken ones, which are reported with
+// the returned error.
+func CompileAll(rules []internal.Rule) ([]*Rule, error) {
+	result := make([]*Rule, 0, len(rules))
+	var errs []string
+	for _, r := range rules {
+		c, err := Compile(r)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("rule %s: %v", r.ID, err))
+			continue
+		}
+		result = append(result, c)
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+func (r *Rule) Match(env Env) bool {
+	return r.expr.Eval(env)
+}
+
+// Apply evaluates rules of the stage in order against env. Rewrites change
+// env in place, so later rules see rewritten fields. Evaluation stops at the
+// first matched drop rule.
+func Apply(rules []*Rule, stage string, env Env) Outcome {
+	var out Outcome
+	for _, r := range rules {
+		if r.Stage != stage || !r.Match(env) {
+			continue
+		}
+
+		switch r.Action {
+		case internal.RuleActionDrop:
+			out.Drop = true
+			return out
+		case internal.RuleActionSkipPage:
+			out.SkipPage = true
+		case internal.RuleActionMarkRead:
+			out.MarkRead = true
+		case internal.RuleActionTag:
+			out.Tags = appendUnique(out.Tags, r.Value)
+		case internal.RuleActionStrip:
+			for _, sel := range strings.Split(r.Value, ",") {
+				sel = strings.TrimSpace(sel)
+				if sel != "" {
+					out.Strip = append(out.Strip, sel)
+				}
+			}
+		case internal.RuleActionRewrite:
+			env[r.Field] = r.pattern.ReplaceAllString(env[r.Field], r.Value)
+		}
+	}
+	return out
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// RecordEnv makes an environment of record fields.
+func RecordEnv(rec *internal.Record, feedSlug string) Env {
+	return Env{
+		"title":       rec.Title,
+		"description": rec.Description,
+		"content":     rec.Content,
+		"link":        rec.Link,
+		"feed":        feedSlug,
+	}
+}
+
+// Update copies rewritable fields from env back to the record.
+func (env Env) Update(rec *internal.Record) {
+	rec.Title = env["title"]
+	rec.Description = env["description"]
+	rec.Content = env["content"]
+	rec.Link = env["link"]
+}
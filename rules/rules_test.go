@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+func TestParse(t *testing.T) {
+	env := Env{
+		"title": "Sponsored: Buy our stuff",
+		"link":  "https://example.com/jobs/1",
+		"feed":  "hn",
+	}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{``, true},
+		{`title contains "Sponsored"`, true},
+		{`title contains "sponsored"`, false},
+		{`title icontains "sponsored"`, true},
+		{`feed == "hn" and link startswith "https://example.com/"`, true},
+		{`feed != "hn" or not (title endswith "stuff")`, false},
+		{`link matches "/jobs/\\d+$"`, true},
+		{`not title matches "(?i)^ad:"`, true},
+		{`(feed == "a" or feed == "hn") and true`, true},
+		{`description == ''`, true},
+	}
+
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", test.expr, err)
+			continue
+		}
+		if expr.Eval(env) != test.match {
+			t.Errorf("Expression %s gives %v", test.expr, !test.match)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	exprs := []string{
+		`title`,
+		`title contains`,
+		`author == "x"`,
+		`title = "x"`,
+		`title == "x`,
+		`(title == "x"`,
+		`title == "x" and`,
+		`link matches "("`,
+		`title == "x" title == "y"`,
+	}
+
+	for _, src := range exprs {
+		_, err := Parse(src)
+		if err == nil {
+			t.Errorf("Expected error for %s", src)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	list, err := CompileAll([]internal.Rule{
+		{ID: "1", Stage: "record", Expr: `title startswith "[Ad]"`, Action: "drop"},
+		{ID: "2", Stage: "record", Expr: `link contains "youtube.com"`, Action: "skip_page"},
+		{ID: "3", Stage: "record", Expr: ``, Action: "rewrite", Field: "title", Pattern: `\s*\| Example$`, Value: ""},
+		{ID: "4", Stage: "record", Expr: `title icontains "golang"`, Action: "tag", Value: "go"},
+		{ID: "5", Stage: "page", Expr: ``, Action: "mark_read"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := Env{"title": "Golang news | Example", "link": "https://youtube.com/watch"}
+	out := Apply(list, "record", env)
+	if out.Drop || !out.SkipPage || out.MarkRead {
+		t.Errorf("Wrong outcome %+v", out)
+	}
+	if env["title"] != "Golang news" {
+		t.Errorf("Title is not rewritten: %q", env["title"])
+	}
+	if len(out.Tags) != 1 || out.Tags[0] != "go" {
+		t.Errorf("Wrong tags %v", out.Tags)
+	}
+
+	out = Apply(list, "record", Env{"title": "[Ad] Buy"})
+	if !out.Drop {
+		t.Errorf("Ad is not dropped")
+	}
+}
+
+func TestCompileStage(t *testing.T) {
+	_, err := Compile(internal.Rule{Stage: "page", Action: "drop"})
+	if err == nil {
+		t.Errorf("Drop is allowed in page stage")
+	}
+	_, err = Compile(internal.Rule{Stage: "record", Action: "strip", Value: ".ad"})
+	if err == nil {
+		t.Errorf("Strip is allowed in record stage")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+type feedRun struct {
+	cancel  context.CancelFunc
+	refresh chan struct{}
+}
+
+// scheduler runs a goroutine fetching each feed. Feeds are started,
+// restarted and stopped as they are changed through the API.
+type scheduler struct {
+	db    store.Store
+	news  chan internal.Record
+	mu    sync.Mutex
+	feeds map[string]*feedRun
+}
+
+func newScheduler(db store.Store, news chan internal.Record) *scheduler {
+	return &scheduler{
+		db:    db,
+		news:  news,
+		feeds: map[string]*feedRun{},
+	}
+}
+
+// Start runs the feed. A running feed is restarted with the new settings.
+func (s *scheduler) Start(feed internal.Feed) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run, ok := s.feeds[feed.ID]; ok {
+		run.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &feedRun{
+		cancel:  cancel,
+		refresh: make(chan struct{}, 1),
+	}
+	s.feeds[feed.ID] = run
+	go runFeed(ctx, s.db, feed, s.news, run.refresh)
+}
+
+// Stop stops fetching the feed.
+func (s *scheduler) Stop(feedID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run, ok := s.feeds[feedID]; ok {
+		run.cancel()
+		delete(s.feeds, feedID)
+	}
+}
+
+// Refresh asks to fetch the feed now. It returns false if the feed is not
+// running.
+func (s *scheduler) Refresh(feedID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.feeds[feedID]
+	if !ok {
+		return false
+	}
+	select {
+	case run.refresh <- struct{}{}:
+	default:
+		// A refresh is pending already.
+	}
+	return true
+}
+
+// Push adds records of the feed content pushed by its WebSub hub. The
+// content is parsed before Push returns, records are added after, so the
+// hub does not wait for pages of the records to be queued.
+func (s *scheduler) Push(feed internal.Feed, body []byte) error {
+	records, err := parseFeedRecords(&feed, body)
+	if err != nil {
+		return err
+	}
+	go func() {
+		count := addRecords(s.db, feed, records, s.news)
+		log.Printf("Pushed %d new records (%d total) to feed %s", count, len(records), feed.Slug)
+	}()
+	return nil
+}
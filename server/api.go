@@ -0,0 +1,468 @@
+package server
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gosimple/slug"
+	"github.com/tmshv/feeder/internal"
+)
+
+//go:embed openapi.json
+var openapi []byte
+
+const (
+	// minRefreshMs keeps feeds from being fetched too often.
+	minRefreshMs = 60000
+	maxLimit     = 500
+)
+
+// apiRoutes serves the JSON API described by /api/openapi.json. Reading
+// needs a user, changing feeds needs an admin.
+func (s *Server) apiRoutes() {
+	s.app.Get("/api/openapi.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(openapi)
+	})
+
+	s.app.Get("/api/feeds", s.requireReader, s.listFeeds)
+	s.app.Post("/api/feeds", s.requireAdmin, s.createFeed)
+	s.app.Get("/api/feeds/:id", s.requireReader, s.showFeed)
+	s.app.Patch("/api/feeds/:id", s.requireAdmin, s.updateFeed)
+	s.app.Delete("/api/feeds/:id", s.requireAdmin, s.deleteFeed)
+	s.app.Post("/api/feeds/:id/refresh", s.requireAdmin, s.refreshFeed)
+
+	s.app.Get("/api/records", s.requireReader, s.listRecords)
+	s.app.Get("/api/records/:id", s.requireReader, s.showRecord)
+
+	s.app.Get("/api/pages", s.requireReader, s.listPages)
+}
+
+// findFeed looks the feed up by id or by slug.
+func (s *Server) findFeed(value string) (internal.Feed, error) {
+	feed, err := s.db.GetFeedByID(value)
+	if err == nil {
+		return feed, nil
+	}
+	return s.db.GetFeedBySlug(value)
+}
+
+// feedInput is a feed in requests. Fields left out are not changed.
+type feedInput struct {
+	Slug      *string                `json:"slug"`
+	Url       *string                `json:"url"`
+	RefreshMs *int64                 `json:"refreshMs"`
+	Extract   *internal.ExtractRules `json:"extract"`
+}
+
+func (in feedInput) apply(feed *internal.Feed) {
+	if in.Slug != nil {
+		feed.Slug = *in.Slug
+	}
+	if in.Url != nil {
+		feed.Url = *in.Url
+	}
+	if in.RefreshMs != nil {
+		feed.RefreshMs = *in.RefreshMs
+	}
+	if in.Extract != nil {
+		feed.Extract = *in.Extract
+	}
+}
+
+func validateFeed(feed internal.Feed) error {
+	if !slug.IsSlug(feed.Slug) {
+		return fmt.Errorf("slug must be lowercase letters, digits and dashes")
+	}
+	u, err := url.Parse(feed.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if feed.RefreshMs < minRefreshMs {
+		return fmt.Errorf("refreshMs must be at least %d", minRefreshMs)
+	}
+	return nil
+}
+
+// checkFeedConflict returns an error if another feed or a saved search has
+// the slug or another feed has the url.
+func (s *Server) checkFeedConflict(feed internal.Feed) error {
+	other, err := s.db.GetFeedBySlug(feed.Slug)
+	if err == nil && other.ID != feed.ID {
+		return fmt.Errorf("slug %s is taken", feed.Slug)
+	}
+	_, err = s.db.GetSavedSearchBySlug(feed.Slug)
+	if err == nil {
+		return fmt.Errorf("slug %s is taken by a saved search", feed.Slug)
+	}
+	other, err = s.db.FindFeedByUrl(feed.Url)
+	if err == nil && other.ID != feed.ID {
+		return fmt.Errorf("url is followed by feed %s", other.Slug)
+	}
+	return nil
+}
+
+func (s *Server) listFeeds(c *fiber.Ctx) error {
+	feeds, err := s.db.GetFeeds()
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get feeds",
+		})
+	}
+	return c.JSON(feeds)
+}
+
+func (s *Server) showFeed(c *fiber.Ctx) error {
+	feed, err := s.findFeed(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+	return c.JSON(feed)
+}
+
+// createFeed adds a feed and starts fetching it. The slug is made of the
+// url if it is not given.
+func (s *Server) createFeed(c *fiber.Ctx) error {
+	var in feedInput
+	err := c.BodyParser(&in)
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad request body",
+		})
+	}
+
+	feed := internal.Feed{RefreshMs: minRefreshMs}
+	in.apply(&feed)
+	if in.Slug == nil {
+		feed.Slug = urlSlug(feed.Url)
+	}
+	err = validateFeed(feed)
+	if err != nil {
+		return c.Status(422).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	err = s.checkFeedConflict(feed)
+	if err != nil {
+		return c.Status(409).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	feed, err = s.addFeed(feed)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to add feed",
+		})
+	}
+	return c.Status(201).JSON(feed)
+}
+
+// urlSlug makes a feed slug of the host and path of the url.
+func urlSlug(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return slug.Make(u.Host + u.Path)
+}
+
+// addFeed stores the validated feed and starts fetching it.
+func (s *Server) addFeed(feed internal.Feed) (internal.Feed, error) {
+	err := s.db.AddFeed(feed.Slug, feed.Url)
+	if err != nil {
+		return feed, err
+	}
+	added, err := s.db.GetFeedBySlug(feed.Slug)
+	if err != nil {
+		return feed, err
+	}
+	feed.ID = added.ID
+	err = s.db.UpdateFeed(feed)
+	if err != nil {
+		return feed, err
+	}
+
+	feed, err = s.db.GetFeedByID(feed.ID)
+	if err != nil {
+		return feed, err
+	}
+	if s.runner != nil {
+		s.runner.Start(feed)
+	}
+	return feed, nil
+}
+
+// updateFeed changes fields of the feed given in the body and restarts
+// fetching it.
+func (s *Server) updateFeed(c *fiber.Ctx) error {
+	feed, err := s.findFeed(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+
+	var in feedInput
+	err = c.BodyParser(&in)
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad request body",
+		})
+	}
+	slug := feed.Slug
+	in.apply(&feed)
+	err = validateFeed(feed)
+	if err != nil {
+		return c.Status(422).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	err = s.checkFeedConflict(feed)
+	if err != nil {
+		return c.Status(409).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	err = s.db.UpdateFeed(feed)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to update feed",
+		})
+	}
+	s.cache.invalidate(slug)
+	feed, err = s.db.GetFeedByID(feed.ID)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get feed",
+		})
+	}
+	if s.runner != nil {
+		s.runner.Start(feed)
+	}
+	return c.JSON(feed)
+}
+
+// deleteFeed stops fetching the feed and deletes it with its records.
+func (s *Server) deleteFeed(c *fiber.Ctx) error {
+	feed, err := s.findFeed(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+
+	err = s.removeFeed(feed)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to delete feed",
+		})
+	}
+	return c.SendStatus(204)
+}
+
+// removeFeed stops fetching the feed and deletes it.
+func (s *Server) removeFeed(feed internal.Feed) error {
+	if s.runner != nil {
+		s.runner.Stop(feed.ID)
+	}
+	err := s.db.DeleteFeed(feed.ID)
+	if err != nil {
+		return err
+	}
+	s.cache.invalidate(feed.Slug)
+	return nil
+}
+
+func (s *Server) refreshFeed(c *fiber.Ctx) error {
+	feed, err := s.findFeed(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+	if s.runner == nil || !s.runner.Refresh(feed.ID) {
+		return c.Status(409).JSON(&fiber.Map{
+			"error": "Feed is not running",
+		})
+	}
+	return c.Status(202).JSON(&fiber.Map{
+		"id": feed.ID,
+	})
+}
+
+func queryLimit(c *fiber.Ctx, def int) int {
+	limit := c.QueryInt("limit", def)
+	if limit <= 0 || limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// listRecords lists records newest first. The next cursor is passed as
+// before to get the following records.
+func (s *Server) listRecords(c *fiber.Ctx) error {
+	filter := internal.RecordFilter{
+		Unread:  c.QueryBool("unread"),
+		Starred: c.QueryBool("starred"),
+		Limit:   queryLimit(c, 100),
+	}
+	if user, ok := currentUser(c); ok && (filter.Unread || filter.Starred) {
+		filter.UserID = user.ID
+	}
+	if value := c.Query("feed"); value != "" {
+		feed, err := s.findFeed(value)
+		if err != nil {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Feed not found",
+			})
+		}
+		filter.FeedIDs = []string{feed.ID}
+	}
+	if name := c.Query("group"); name != "" {
+		group, err := s.db.GetGroupByName(name)
+		if err != nil {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Group not found",
+			})
+		}
+		filter.GroupID = group.ID
+	}
+	var err error
+	filter.Before, filter.BeforeNum, err = parseRecordCursor(c.Query("before"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad before, use 2006-01-02, RFC 3339 or the next value",
+		})
+	}
+
+	records, err := s.db.GetRecords(filter)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get records",
+		})
+	}
+	res := fiber.Map{
+		"records": records,
+	}
+	if len(records) == filter.Limit {
+		res["next"] = recordCursor(records[len(records)-1])
+	}
+	return c.JSON(res)
+}
+
+// recordCursor is the publish time and the sequential id of the record,
+// the last one of a list of records. Records published at the same time
+// are told apart by their ids.
+func recordCursor(rec internal.Record) string {
+	return fmt.Sprintf("%s_%d", rec.PublishedAt.Format(time.RFC3339Nano), rec.Num)
+}
+
+// parseRecordCursor parses the cursor made by recordCursor, or a time
+// without the sequential id.
+func parseRecordCursor(value string) (time.Time, int64, error) {
+	value, num, found := strings.Cut(value, "_")
+	t, err := parseTime(value)
+	if err != nil || !found {
+		return t, 0, err
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return t, 0, fmt.Errorf("bad sequential id %s", num)
+	}
+	return t, n, nil
+}
+
+func (s *Server) showRecord(c *fiber.Ctx) error {
+	rec, err := s.db.GetRecord(c.Params("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Record not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get record",
+		})
+	}
+	return c.JSON(rec)
+}
+
+// listPages lists fetched pages in the order they were stored, or the
+// latest page with the url. Html is left out unless asked with html=true.
+// The next cursor is passed as after to get the following pages.
+func (s *Server) listPages(c *fiber.Ctx) error {
+	withHtml := c.QueryBool("html")
+	if u := c.Query("url"); u != "" {
+		page, err := s.db.GetPage(u)
+		if err != nil {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Page not found",
+			})
+		}
+		if !withHtml {
+			page.Html = ""
+		}
+		return c.JSON(&fiber.Map{
+			"pages": []internal.Page{page},
+		})
+	}
+
+	var filter internal.PageFilter
+	if value := c.Query("feed"); value != "" {
+		feed, err := s.findFeed(value)
+		if err != nil {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Feed not found",
+			})
+		}
+		filter.FeedID = feed.ID
+	}
+	var err error
+	filter.Since, err = parseTime(c.Query("since"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad since, use 2006-01-02 or RFC 3339",
+		})
+	}
+	filter.Until, err = parseTime(c.Query("until"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad until, use 2006-01-02 or RFC 3339",
+		})
+	}
+
+	limit := queryLimit(c, 50)
+	it := s.db.IteratePages(filter, int64(c.QueryInt("after", 0)))
+	pages := make([]internal.Page, 0)
+	for len(pages) < limit && it.Next() {
+		page := it.Page()
+		if !withHtml {
+			page.Html = ""
+		}
+		pages = append(pages, page)
+	}
+	if it.Err() != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get pages",
+		})
+	}
+
+	res := fiber.Map{
+		"pages": pages,
+	}
+	if len(pages) == limit {
+		res["next"] = it.Cursor()
+	}
+	return c.JSON(res)
+}
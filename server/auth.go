@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+)
+
+// authenticate finds the user signing the request with an API token
+// (Authorization: Bearer, or GoogleLogin auth= of Google Reader clients),
+// a password (HTTP basic auth) or a feed token
+// (?token=). Feed tokens are read-only and accepted by GET requests only.
+// Requests without credentials pass anonymous, routes require users with
+// requireReader, requireUser and requireAdmin.
+func (s *Server) authenticate(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderAuthorization)
+	scheme, value, _ := strings.Cut(header, " ")
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		user, err := s.db.FindUserByToken(auth.HashToken(strings.TrimSpace(value)), internal.TokenKindApi)
+		if err != nil {
+			return unauthorized(c)
+		}
+		c.Locals("user", user)
+	case strings.EqualFold(scheme, "GoogleLogin"):
+		token, ok := strings.CutPrefix(strings.TrimSpace(value), "auth=")
+		if !ok {
+			return unauthorized(c)
+		}
+		user, err := s.db.FindUserByToken(auth.HashToken(token), internal.TokenKindApi)
+		if err != nil {
+			return unauthorized(c)
+		}
+		c.Locals("user", user)
+	case strings.EqualFold(scheme, "Basic"):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return unauthorized(c)
+		}
+		name, password, _ := strings.Cut(string(data), ":")
+		user, err := s.db.GetUserByName(name)
+		if err != nil {
+			return unauthorized(c)
+		}
+		if auth.CheckPassword(user.PasswordHash, password) != nil {
+			return unauthorized(c)
+		}
+		c.Locals("user", user)
+	case header != "":
+		return unauthorized(c)
+	case c.Query("token") != "" && c.Method() == fiber.MethodGet:
+		user, err := s.db.FindUserByToken(auth.HashToken(c.Query("token")), internal.TokenKindFeed)
+		if err != nil {
+			return unauthorized(c)
+		}
+		c.Locals("user", user)
+		c.Locals("readOnly", true)
+	}
+	return c.Next()
+}
+
+func unauthorized(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="feeder"`)
+	return c.Status(401).JSON(&fiber.Map{
+		"error": "Unauthorized",
+	})
+}
+
+// currentUser returns the user signing the request.
+func currentUser(c *fiber.Ctx) (internal.User, bool) {
+	user, ok := c.Locals("user").(internal.User)
+	return user, ok
+}
+
+// requireReader lets in any user, including ones with feed tokens.
+func (s *Server) requireReader(c *fiber.Ctx) error {
+	if s.noAuth {
+		return c.Next()
+	}
+	if _, ok := currentUser(c); !ok {
+		return unauthorized(c)
+	}
+	return c.Next()
+}
+
+// requireUser lets in users signed in with a password or an API token.
+// The user is required even if authentication is off.
+func (s *Server) requireUser(c *fiber.Ctx) error {
+	if _, ok := currentUser(c); !ok || c.Locals("readOnly") != nil {
+		return unauthorized(c)
+	}
+	return c.Next()
+}
+
+// requireAdmin lets in admins signed in with a password or an API token.
+func (s *Server) requireAdmin(c *fiber.Ctx) error {
+	if s.noAuth {
+		return c.Next()
+	}
+	user, ok := currentUser(c)
+	if !ok || c.Locals("readOnly") != nil {
+		return unauthorized(c)
+	}
+	if !user.Admin {
+		return c.Status(403).JSON(&fiber.Map{
+			"error": "Admin only",
+		})
+	}
+	return c.Next()
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+// authStore knows users and tokens only. Other methods of the store panic.
+type authStore struct {
+	store.Store
+	users  map[string]internal.User
+	tokens map[string]internal.Token
+}
+
+func (m *authStore) GetUserByName(name string) (internal.User, error) {
+	user, ok := m.users[name]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *authStore) FindUserByToken(hash string, kind string) (internal.User, error) {
+	token, ok := m.tokens[hash]
+	if !ok || token.Kind != kind {
+		return internal.User{}, sql.ErrNoRows
+	}
+	for _, user := range m.users {
+		if user.ID == token.UserID {
+			return user, nil
+		}
+	}
+	return internal.User{}, sql.ErrNoRows
+}
+
+func newAuthStore(t *testing.T) *authStore {
+	hash, err := auth.HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authStore{
+		users: map[string]internal.User{
+			"alice": {ID: "1", Name: "alice", PasswordHash: hash},
+			"bob":   {ID: "2", Name: "bob", PasswordHash: hash, Admin: true},
+		},
+		tokens: map[string]internal.Token{
+			auth.HashToken("alice-api"):  {UserID: "1", Kind: internal.TokenKindApi},
+			auth.HashToken("alice-feed"): {UserID: "1", Kind: internal.TokenKindFeed},
+			auth.HashToken("bob-api"):    {UserID: "2", Kind: internal.TokenKindApi},
+			auth.HashToken("bob-feed"):   {UserID: "2", Kind: internal.TokenKindFeed},
+		},
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		noAuth bool
+		method string
+		target string
+		header string
+		// Statuses of requireReader, requireUser and requireAdmin.
+		reader, user, admin int
+	}{
+		{name: "anonymous", target: "/", reader: 401, user: 401, admin: 401},
+		{name: "anonymous without auth", noAuth: true, target: "/", reader: 200, user: 401, admin: 200},
+		{name: "wrong password", target: "/", header: "Basic YWxpY2U6eA==", reader: 401, user: 401, admin: 401},
+		{name: "unknown scheme", target: "/", header: "Digest x", reader: 401, user: 401, admin: 401},
+		{name: "unknown token", target: "/", header: "Bearer x", reader: 401, user: 401, admin: 401},
+		{name: "user password", target: "/", header: "Basic YWxpY2U6cHc=", reader: 200, user: 200, admin: 403},
+		{name: "user api token", target: "/", header: "Bearer alice-api", reader: 200, user: 200, admin: 403},
+		{name: "user greader token", target: "/", header: "GoogleLogin auth=alice-api", reader: 200, user: 200, admin: 403},
+		{name: "user feed token", target: "/?token=alice-feed", reader: 200, user: 401, admin: 401},
+		{name: "user feed token as api token", target: "/", header: "Bearer alice-feed", reader: 401, user: 401, admin: 401},
+		{name: "user feed token of post", method: "POST", target: "/?token=alice-feed", reader: 401, user: 401, admin: 401},
+		{name: "admin password", target: "/", header: "Basic Ym9iOnB3", reader: 200, user: 200, admin: 200},
+		{name: "admin api token", target: "/", header: "Bearer bob-api", reader: 200, user: 200, admin: 200},
+		{name: "admin feed token", target: "/?token=bob-feed", reader: 200, user: 401, admin: 401},
+		{name: "admin feed token without auth", noAuth: true, target: "/?token=bob-feed", reader: 200, user: 401, admin: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: newAuthStore(t), app: fiber.New(), noAuth: tt.noAuth}
+			ok := func(c *fiber.Ctx) error { return c.SendStatus(200) }
+			s.app.Use(s.authenticate)
+			s.app.All("/reader", s.requireReader, ok)
+			s.app.All("/user", s.requireUser, ok)
+			s.app.All("/admin", s.requireAdmin, ok)
+
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			for path, want := range map[string]int{"/reader": tt.reader, "/user": tt.user, "/admin": tt.admin} {
+				req := httptest.NewRequest(method, path+tt.target[1:], nil)
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				res, err := s.app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.StatusCode != want {
+					t.Errorf("%s %s = %d, want %d", method, path, res.StatusCode, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/events"
+	"github.com/tmshv/feeder/render"
+)
+
+const (
+	// feedMaxAge is the number of seconds clients may use a feed without
+	// asking for it again.
+	feedMaxAge = 60
+	// cacheTTL bounds the time a rendered feed is served from memory, as
+	// feeds may change out of the server, by reprocessing for one.
+	cacheTTL = 10 * time.Minute
+	// cacheSize is the number of rendered feeds kept in memory.
+	cacheSize = 256
+)
+
+// cachedFeed is a rendered feed with its validators.
+type cachedFeed struct {
+	slug        string
+	contentType string
+	link        string
+	body        []byte
+	etag        string
+	modifiedAt  time.Time
+	storedAt    time.Time
+}
+
+// feedCache keeps rendered feeds by request URL until records of the feed
+// are added. A nil cache keeps nothing.
+type feedCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedFeed
+	// versions of slugs change on every invalidation, so feeds rendered
+	// before it are not kept.
+	versions map[string]uint64
+}
+
+func newFeedCache() *feedCache {
+	return &feedCache{
+		entries:  map[string]*cachedFeed{},
+		versions: map[string]uint64{},
+	}
+}
+
+// version is passed to put the feed of the slug rendered after it.
+func (fc *feedCache) version(slug string) uint64 {
+	if fc == nil {
+		return 0
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.versions[slug]
+}
+
+func (fc *feedCache) get(key string) (*cachedFeed, bool) {
+	if fc == nil {
+		return nil, false
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	entry, ok := fc.entries[key]
+	if !ok || time.Since(entry.storedAt) > cacheTTL {
+		return nil, false
+	}
+	return entry, true
+}
+
+// put keeps the feed, dropping the oldest one if the cache is full. Feeds
+// of slugs invalidated since the version are not kept.
+func (fc *feedCache) put(key string, entry *cachedFeed, version uint64) {
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.versions[entry.slug] != version {
+		return
+	}
+	if _, ok := fc.entries[key]; !ok && len(fc.entries) >= cacheSize {
+		oldest := ""
+		for k, e := range fc.entries {
+			if oldest == "" || e.storedAt.Before(fc.entries[oldest].storedAt) {
+				oldest = k
+			}
+		}
+		delete(fc.entries, oldest)
+	}
+	entry.storedAt = time.Now()
+	fc.entries[key] = entry
+}
+
+// invalidate drops rendered feeds of the slug.
+func (fc *feedCache) invalidate(slug string) {
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.versions[slug] += 1
+	for k, e := range fc.entries {
+		if e.slug == slug {
+			delete(fc.entries, k)
+		}
+	}
+}
+
+// invalidateCache drops rendered feeds getting new records or pages. It is
+// a hook of the bus, called by writers of records and pages right after
+// they are stored.
+func (s *Server) invalidateCache(e events.Event) {
+	if e.Type == events.RecordCreated || e.Type == events.PageExtracted {
+		s.cache.invalidate(e.Feed)
+	}
+}
+
+// feedEtag makes the entity tag of a feed modified at the time rendered
+// in the format. Formats of the same feed are told apart, so clients
+// switching formats do not get 304 for the other one. Unknown formats are
+// rendered as JSON Feed.
+func feedEtag(modifiedAt time.Time, format string) string {
+	if format != render.FormatRSS && format != render.FormatAtom {
+		format = render.FormatJSON
+	}
+	return fmt.Sprintf(`"%x-%s"`, modifiedAt.UnixNano(), format)
+}
+
+// setValidators adds caching headers of the feed modified at the time.
+// Feeds are cached privately unless authentication is off.
+func (s *Server) setValidators(c *fiber.Ctx, etag string, modifiedAt time.Time) {
+	c.Set(fiber.HeaderETag, etag)
+	if !modifiedAt.IsZero() {
+		c.Set(fiber.HeaderLastModified, modifiedAt.UTC().Format(http.TimeFormat))
+	}
+	visibility := "private"
+	if s.noAuth {
+		visibility = "public"
+	}
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("%s, max-age=%d", visibility, feedMaxAge))
+}
+
+// notModified tells if the client has the feed of the validators already.
+// If-None-Match takes precedence over If-Modified-Since.
+func notModified(c *fiber.Ctx, etag string, modifiedAt time.Time) bool {
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	if err != nil || modifiedAt.IsZero() {
+		return false
+	}
+	return !modifiedAt.Truncate(time.Second).After(since)
+}
+
+// sendCachedFeed writes the rendered feed, or 304 if the client has it.
+func (s *Server) sendCachedFeed(c *fiber.Ctx, entry *cachedFeed) error {
+	s.setValidators(c, entry.etag, entry.modifiedAt)
+	if notModified(c, entry.etag, entry.modifiedAt) {
+		return c.SendStatus(304)
+	}
+	c.Set(fiber.HeaderContentType, entry.contentType)
+	if entry.link != "" {
+		c.Set(fiber.HeaderLink, entry.link)
+	}
+	return c.Send(entry.body)
+}
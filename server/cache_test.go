@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/tmshv/feeder/events"
+)
+
+func TestFeedCacheInvalidate(t *testing.T) {
+	s := &Server{cache: newFeedCache()}
+	version := s.cache.version("news")
+	s.cache.put("/feed/news", &cachedFeed{slug: "news"}, version)
+	s.cache.put("/feed/blog", &cachedFeed{slug: "blog"}, s.cache.version("blog"))
+
+	// A feed rendered before new records is not kept.
+	stale := s.cache.version("news")
+	s.invalidateCache(events.Event{Type: events.RecordCreated, Feed: "news"})
+	s.cache.put("/feed/news?format=rss", &cachedFeed{slug: "news"}, stale)
+
+	if _, ok := s.cache.get("/feed/news"); ok {
+		t.Error("Kept the feed with new records")
+	}
+	if _, ok := s.cache.get("/feed/news?format=rss"); ok {
+		t.Error("Kept the feed rendered before new records")
+	}
+	if _, ok := s.cache.get("/feed/blog"); !ok {
+		t.Error("Dropped the feed of other records")
+	}
+
+	s.invalidateCache(events.Event{Type: events.FeedFailed, Feed: "blog"})
+	if _, ok := s.cache.get("/feed/blog"); !ok {
+		t.Error("Dropped the feed failed to fetch")
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/events"
+)
+
+// keepAlive is the period of comments sent to idle event streams, so
+// proxies do not close them.
+const keepAlive = 15 * time.Second
+
+// getEvents streams events as Server-Sent Events. Events are filtered by
+// comma separated lists of types, feed slugs and tags given with the type,
+// feed and tag query parameters. Clients reconnecting with Last-Event-ID
+// get recent events they missed.
+func (s *Server) getEvents(c *fiber.Ctx) error {
+	if s.bus == nil {
+		return c.Status(503).JSON(&fiber.Map{
+			"error": "Events are not available",
+		})
+	}
+
+	filter := events.Filter{
+		Types: splitList(c.Query("type")),
+		Feeds: splitList(c.Query("feed")),
+		Tags:  splitList(c.Query("tag")),
+	}
+	lastID, _ := strconv.ParseInt(c.Get("Last-Event-ID"), 10, 64)
+	sub := s.bus.Subscribe(filter, lastID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		fmt.Fprint(w, ": connected\n\n")
+		for {
+			if err := w.Flush(); err != nil {
+				// The client is gone.
+				return
+			}
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+		}
+	})
+	return nil
+}
+
+// splitList splits a comma separated query parameter.
+func splitList(value string) []string {
+	var result []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+)
+
+const feverMaxItems = 50
+
+// feverRoutes serves the Fever API at /fever/?api. Clients sign in with
+// api_key, md5 of name:password with the password made by feeder user
+// fever, and ask for sections with query
+// parameters: groups, feeds, favicons, items, links, unread_item_ids and
+// saved_item_ids. Marks are posted with mark, as, id and before. Feeds,
+// groups and records are given by their sequential ids.
+func (s *Server) feverRoutes() {
+	s.app.All("/fever", s.fever)
+	s.app.All("/fever/", s.fever)
+}
+
+func (s *Server) fever(c *fiber.Ctx) error {
+	res := fiber.Map{
+		"api_version": 3,
+		"auth":        0,
+	}
+	if !c.Context().QueryArgs().Has("api") {
+		return c.Status(400).JSON(res)
+	}
+
+	key := c.FormValue("api_key")
+	if key == "" {
+		key = c.Query("api_key")
+	}
+	user, err := s.db.FindUserByFeverKey(auth.HashToken(strings.ToLower(key)))
+	if key == "" || err != nil {
+		return c.JSON(res)
+	}
+	res["auth"] = 1
+	res["last_refreshed_on_time"] = time.Now().Unix()
+
+	if c.FormValue("mark") != "" {
+		err = s.feverMark(c, user)
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	args := c.Context().QueryArgs()
+	var feeds []internal.Feed
+	var groups []internal.Group
+	if args.Has("groups") || args.Has("feeds") {
+		feeds, err = s.db.GetSubscriptions(user.ID)
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get subscriptions",
+			})
+		}
+		groups, err = s.db.GetGroups()
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get groups",
+			})
+		}
+		feedsGroups, err := s.feverFeedsGroups(feeds, groups)
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get groups",
+			})
+		}
+		res["feeds_groups"] = feedsGroups
+	}
+	if args.Has("groups") {
+		items := make([]fiber.Map, 0, len(groups))
+		for _, group := range groups {
+			items = append(items, fiber.Map{
+				"id":    group.Num,
+				"title": group.Name,
+			})
+		}
+		res["groups"] = items
+	}
+	if args.Has("feeds") {
+		items := make([]fiber.Map, 0, len(feeds))
+		for _, feed := range feeds {
+			items = append(items, fiber.Map{
+				"id":                   feed.Num,
+				"favicon_id":           0,
+				"title":                feed.Slug,
+				"url":                  feed.Url,
+				"site_url":             feed.Url,
+				"is_spark":             0,
+				"last_updated_on_time": feed.UpdatedAt.Unix(),
+			})
+		}
+		res["feeds"] = items
+	}
+	if args.Has("favicons") {
+		res["favicons"] = []fiber.Map{}
+	}
+	if args.Has("links") {
+		res["links"] = []fiber.Map{}
+	}
+	if args.Has("items") {
+		items, total, err := s.feverItems(c, user)
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get records",
+			})
+		}
+		res["items"] = items
+		res["total_items"] = total
+	}
+	if args.Has("unread_item_ids") {
+		nums, err := s.db.GetRecordNums(internal.RecordFilter{UserID: user.ID, Unread: true})
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get records",
+			})
+		}
+		res["unread_item_ids"] = joinNums(nums)
+	}
+	if args.Has("saved_item_ids") {
+		nums, err := s.db.GetRecordNums(internal.RecordFilter{UserID: user.ID, Starred: true})
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get records",
+			})
+		}
+		res["saved_item_ids"] = joinNums(nums)
+	}
+	return c.JSON(res)
+}
+
+// feverFeedsGroups lists feeds of the user in each group as comma
+// separated ids.
+func (s *Server) feverFeedsGroups(feeds []internal.Feed, groups []internal.Group) ([]fiber.Map, error) {
+	subscribed := map[string]bool{}
+	for _, feed := range feeds {
+		subscribed[feed.ID] = true
+	}
+	result := make([]fiber.Map, 0, len(groups))
+	for _, group := range groups {
+		groupFeeds, err := s.db.GetGroupFeeds(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		var nums []int64
+		for _, feed := range groupFeeds {
+			if subscribed[feed.ID] {
+				nums = append(nums, feed.Num)
+			}
+		}
+		result = append(result, fiber.Map{
+			"group_id": group.Num,
+			"feed_ids": joinNums(nums),
+		})
+	}
+	return result, nil
+}
+
+// feverItems lists up to 50 records after since_id, before max_id or with
+// with_ids, newest first if none is given.
+func (s *Server) feverItems(c *fiber.Ctx, user internal.User) ([]fiber.Map, int, error) {
+	filter := internal.RecordFilter{
+		UserID: user.ID,
+		Limit:  feverMaxItems,
+	}
+	if ids := c.Query("with_ids"); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			num, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+			if err == nil {
+				filter.Nums = append(filter.Nums, num)
+			}
+		}
+		if len(filter.Nums) > feverMaxItems {
+			filter.Nums = filter.Nums[:feverMaxItems]
+		}
+	}
+	if id := c.QueryInt("since_id"); id > 0 {
+		filter.AfterNum = int64(id)
+	}
+	if id := c.QueryInt("max_id"); id > 0 {
+		filter.BeforeNum = int64(id)
+	}
+
+	total, err := s.db.GetRecordNums(internal.RecordFilter{UserID: user.ID})
+	if err != nil {
+		return nil, 0, err
+	}
+	feeds, err := s.db.GetSubscriptions(user.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	feedNums := map[string]int64{}
+	for _, feed := range feeds {
+		feedNums[feed.ID] = feed.Num
+	}
+	records := make([]internal.Record, 0)
+	if c.Query("with_ids") == "" || len(filter.Nums) > 0 {
+		records, err = s.db.GetRecords(filter)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	items := make([]fiber.Map, 0, len(records))
+	for _, rec := range records {
+		link := rec.Link
+		if rec.CanonicalLink != "" {
+			link = rec.CanonicalLink
+		}
+		items = append(items, fiber.Map{
+			"id":              rec.Num,
+			"feed_id":         feedNums[rec.FeedID],
+			"title":           rec.Title,
+			"author":          "",
+			"html":            string(recordHtml(rec)),
+			"url":             link,
+			"is_saved":        boolInt(!rec.StarredAt.IsZero()),
+			"is_read":         boolInt(!rec.ReadAt.IsZero()),
+			"created_on_time": rec.PublishedAt.Unix(),
+		})
+	}
+	return items, len(total), nil
+}
+
+// feverMark changes state of an item (mark=item, as=read, unread, saved or
+// unsaved) or marks a feed or a group read before a time (mark=feed or
+// group, as=read, before). Group 0 is all feeds of the user.
+func (s *Server) feverMark(c *fiber.Ctx, user internal.User) error {
+	id, err := strconv.ParseInt(c.FormValue("id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	switch c.FormValue("mark") {
+	case "item":
+		records, err := s.db.GetRecords(internal.RecordFilter{
+			UserID: user.ID,
+			Nums:   []int64{id},
+			Limit:  1,
+		})
+		if err != nil || len(records) == 0 {
+			return err
+		}
+		state, on := "", false
+		switch c.FormValue("as") {
+		case "read":
+			state, on = internal.RecordStateRead, true
+		case "unread":
+			state, on = internal.RecordStateRead, false
+		case "saved":
+			state, on = internal.RecordStateStarred, true
+		case "unsaved":
+			state, on = internal.RecordStateStarred, false
+		default:
+			return nil
+		}
+		return s.db.SetUserRecordState(user.ID, records[0].ID, state, on)
+
+	case "feed", "group":
+		if c.FormValue("as") != "read" {
+			return nil
+		}
+		before := time.Now()
+		if ts, err := strconv.ParseInt(c.FormValue("before"), 10, 64); err == nil && ts > 0 {
+			before = time.Unix(ts, 0)
+		}
+		feeds, err := s.feverMarkFeeds(user, c.FormValue("mark"), id)
+		if err != nil {
+			return err
+		}
+		for _, feed := range feeds {
+			_, err = s.db.MarkUserFeedRead(user.ID, feed.ID, before)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// feverMarkFeeds finds subscriptions of the user with the sequential id
+// of the feed or in the group with the id.
+func (s *Server) feverMarkFeeds(user internal.User, mark string, id int64) ([]internal.Feed, error) {
+	feeds, err := s.db.GetSubscriptions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mark == "group" && id == 0 {
+		return feeds, nil
+	}
+
+	in := map[string]bool{}
+	if mark == "group" {
+		groups, err := s.db.GetGroups()
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if group.Num != id {
+				continue
+			}
+			groupFeeds, err := s.db.GetGroupFeeds(group.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, feed := range groupFeeds {
+				in[feed.ID] = true
+			}
+		}
+	}
+
+	result := make([]internal.Feed, 0)
+	for _, feed := range feeds {
+		if (mark == "feed" && feed.Num == id) || in[feed.ID] {
+			result = append(result, feed)
+		}
+	}
+	return result, nil
+}
+
+func joinNums(nums []int64) string {
+	parts := make([]string, 0, len(nums))
+	for _, num := range nums {
+		parts = append(parts, strconv.FormatInt(num, 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,580 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+)
+
+// Stream ids and tags of the Google Reader API.
+const (
+	greaderItemPrefix  = "tag:google.com,2005:reader/item/"
+	greaderReadingList = "user/-/state/com.google/reading-list"
+	greaderRead        = "user/-/state/com.google/read"
+	greaderStarred     = "user/-/state/com.google/starred"
+	greaderKeptUnread  = "user/-/state/com.google/kept-unread"
+	greaderLabelPrefix = "user/-/label/"
+	greaderFeedPrefix  = "feed/"
+
+	greaderMaxItems = 1000
+	// greaderTokenName names API tokens given by ClientLogin.
+	greaderTokenName = "greader"
+)
+
+// greaderRoutes serves the subset of the Google Reader API used by mobile
+// clients: ClientLogin, subscription and tag lists, stream contents and
+// edit-tag for read and starred state. Groups are served as labels.
+func (s *Server) greaderRoutes() {
+	s.app.Post("/accounts/ClientLogin", s.greaderLogin)
+
+	r := s.app.Group("/reader/api/0", s.requireUser)
+	r.Get("/token", s.greaderToken)
+	r.Get("/user-info", s.greaderUserInfo)
+	r.Get("/subscription/list", s.greaderSubscriptions)
+	r.Get("/tag/list", s.greaderTags)
+	r.Get("/stream/contents/*", s.greaderStreamContents)
+	r.Get("/stream/items/ids", s.greaderItemIds)
+	r.Get("/stream/items/contents", s.greaderItemContents)
+	r.Post("/stream/items/contents", s.greaderItemContents)
+	r.Post("/edit-tag", s.greaderEditTag)
+	r.Post("/mark-all-as-read", s.greaderMarkAllRead)
+}
+
+// greaderLogin checks the password of the user and gives a new API token
+// used as Authorization: GoogleLogin auth=<token>. The token replaces the
+// one of the previous login, so clients signing in again and again do not
+// pile up tokens.
+func (s *Server) greaderLogin(c *fiber.Ctx) error {
+	user, err := s.db.GetUserByName(c.FormValue("Email"))
+	if err != nil || auth.CheckPassword(user.PasswordHash, c.FormValue("Passwd")) != nil {
+		return c.Status(401).SendString("Error=BadAuthentication\n")
+	}
+
+	old, err := s.db.GetUserTokens(user.ID)
+	if err != nil {
+		return c.Status(500).SendString("Error=Unknown\n")
+	}
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return c.Status(500).SendString("Error=Unknown\n")
+	}
+	_, err = s.db.AddToken(internal.Token{
+		UserID: user.ID,
+		Kind:   internal.TokenKindApi,
+		Name:   greaderTokenName,
+		Hash:   hash,
+	})
+	if err != nil {
+		return c.Status(500).SendString("Error=Unknown\n")
+	}
+	for _, t := range old {
+		if t.Kind != internal.TokenKindApi || t.Name != greaderTokenName {
+			continue
+		}
+		err = s.db.DeleteToken(t.ID)
+		if err != nil {
+			log.Printf("Failed to delete token %s of %s: %v", t.ID, user.Name, err)
+		}
+	}
+	return c.SendString(fmt.Sprintf("SID=%[1]s\nLSID=%[1]s\nAuth=%[1]s\n", token))
+}
+
+// greaderToken gives the token clients send with edits, an HMAC of the
+// credentials of the session, so it cannot be made without them. Requests
+// are authorized by the header, so it is not checked.
+func (s *Server) greaderToken(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	mac := hmac.New(sha256.New, []byte(c.Get(fiber.HeaderAuthorization)))
+	mac.Write([]byte(user.ID))
+	return c.SendString(hex.EncodeToString(mac.Sum(nil))[:57])
+}
+
+func (s *Server) greaderUserInfo(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	return c.JSON(&fiber.Map{
+		"userId":        user.ID,
+		"userName":      user.Name,
+		"userProfileId": user.ID,
+		"userEmail":     user.Name,
+	})
+}
+
+type greaderCategory struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type greaderSubscription struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Categories []greaderCategory `json:"categories"`
+	Url        string            `json:"url"`
+	HtmlUrl    string            `json:"htmlUrl"`
+	IconUrl    string            `json:"iconUrl"`
+}
+
+// feedGroups maps ids of feeds to groups they are in.
+func (s *Server) feedGroups() (map[string][]internal.Group, error) {
+	groups, err := s.db.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]internal.Group{}
+	for _, group := range groups {
+		feeds, err := s.db.GetGroupFeeds(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, feed := range feeds {
+			result[feed.ID] = append(result[feed.ID], group)
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) greaderSubscriptions(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	feeds, err := s.db.GetSubscriptions(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get subscriptions",
+		})
+	}
+	groups, err := s.feedGroups()
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get groups",
+		})
+	}
+
+	subs := make([]greaderSubscription, 0, len(feeds))
+	for _, feed := range feeds {
+		sub := greaderSubscription{
+			ID:         greaderFeedPrefix + feed.Url,
+			Title:      feed.Slug,
+			Categories: make([]greaderCategory, 0),
+			Url:        feed.Url,
+			HtmlUrl:    feed.Url,
+		}
+		for _, group := range groups[feed.ID] {
+			sub.Categories = append(sub.Categories, greaderCategory{
+				ID:    greaderLabelPrefix + group.Name,
+				Label: group.Name,
+			})
+		}
+		subs = append(subs, sub)
+	}
+	return c.JSON(&fiber.Map{
+		"subscriptions": subs,
+	})
+}
+
+func (s *Server) greaderTags(c *fiber.Ctx) error {
+	groups, err := s.db.GetGroups()
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get groups",
+		})
+	}
+	tags := []fiber.Map{
+		{"id": greaderStarred},
+	}
+	for _, group := range groups {
+		tags = append(tags, fiber.Map{
+			"id":   greaderLabelPrefix + group.Name,
+			"type": "folder",
+		})
+	}
+	return c.JSON(&fiber.Map{
+		"tags": tags,
+	})
+}
+
+// greaderStreamId drops the user id from ids like user/1234/label/News,
+// clients send both it and user/-/label/News.
+func greaderStreamId(id string) string {
+	if !strings.HasPrefix(id, "user/") {
+		return id
+	}
+	parts := strings.SplitN(id, "/", 3)
+	if len(parts) < 3 {
+		return id
+	}
+	return "user/-/" + parts[2]
+}
+
+// greaderItemNum reads the sequential record id from item ids given in the
+// long form tag:google.com,2005:reader/item/<hex> or the short decimal one.
+func greaderItemNum(id string) (int64, error) {
+	if hex, ok := strings.CutPrefix(id, greaderItemPrefix); ok {
+		n, err := strconv.ParseUint(hex, 16, 64)
+		return int64(n), err
+	}
+	return strconv.ParseInt(id, 10, 64)
+}
+
+func greaderItemId(rec internal.Record) string {
+	return fmt.Sprintf("%s%016x", greaderItemPrefix, rec.Num)
+}
+
+// streamFilter selects records of the stream for the user with the
+// parameters of the stream requests: n, c, xt, it, ot and nt.
+func (s *Server) streamFilter(c *fiber.Ctx, user internal.User, streamId string) (internal.RecordFilter, error) {
+	filter := internal.RecordFilter{
+		UserID: user.ID,
+		Limit:  c.QueryInt("n", 20),
+	}
+	if filter.Limit <= 0 || filter.Limit > greaderMaxItems {
+		filter.Limit = greaderMaxItems
+	}
+
+	switch id := greaderStreamId(streamId); {
+	case id == greaderReadingList:
+	case id == greaderStarred:
+		filter.Starred = true
+	case strings.HasPrefix(id, greaderLabelPrefix):
+		group, err := s.db.GetGroupByName(strings.TrimPrefix(id, greaderLabelPrefix))
+		if err != nil {
+			return filter, fmt.Errorf("label not found")
+		}
+		filter.GroupID = group.ID
+	case strings.HasPrefix(id, greaderFeedPrefix):
+		feed, err := s.db.FindFeedByUrl(strings.TrimPrefix(id, greaderFeedPrefix))
+		if err != nil {
+			return filter, fmt.Errorf("feed not found")
+		}
+		filter.FeedIDs = []string{feed.ID}
+	default:
+		return filter, fmt.Errorf("unknown stream %s", streamId)
+	}
+
+	if greaderStreamId(c.Query("xt")) == greaderRead {
+		filter.Unread = true
+	}
+	if greaderStreamId(c.Query("it")) == greaderStarred {
+		filter.Starred = true
+	}
+	if ot := c.QueryInt("ot"); ot > 0 {
+		filter.Since = time.Unix(int64(ot), 0)
+	}
+	if nt := c.QueryInt("nt"); nt > 0 {
+		filter.Before = time.Unix(int64(nt), 0)
+	}
+	if cont := c.Query("c"); cont != "" {
+		before, num, err := parseRecordCursor(cont)
+		if err != nil {
+			return filter, fmt.Errorf("bad continuation")
+		}
+		filter.Before, filter.BeforeNum = before, num
+	}
+	return filter, nil
+}
+
+// continuation is the c parameter of the request following the records,
+// the cursor of the last record.
+func continuation(records []internal.Record, filter internal.RecordFilter) string {
+	if len(records) < filter.Limit {
+		return ""
+	}
+	return recordCursor(records[len(records)-1])
+}
+
+type greaderLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderContent struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type greaderOrigin struct {
+	StreamID string `json:"streamId"`
+	Title    string `json:"title"`
+	HtmlUrl  string `json:"htmlUrl"`
+}
+
+type greaderItem struct {
+	ID            string         `json:"id"`
+	CrawlTimeMsec string         `json:"crawlTimeMsec"`
+	TimestampUsec string         `json:"timestampUsec"`
+	Published     int64          `json:"published"`
+	Updated       int64          `json:"updated"`
+	Title         string         `json:"title"`
+	Canonical     []greaderLink  `json:"canonical"`
+	Alternate     []greaderLink  `json:"alternate"`
+	Summary       greaderContent `json:"summary"`
+	Categories    []string       `json:"categories"`
+	Origin        greaderOrigin  `json:"origin"`
+}
+
+func makeGreaderItem(rec internal.Record) greaderItem {
+	link := rec.Link
+	if rec.CanonicalLink != "" {
+		link = rec.CanonicalLink
+	}
+	categories := []string{greaderReadingList}
+	if !rec.ReadAt.IsZero() {
+		categories = append(categories, greaderRead)
+	}
+	if !rec.StarredAt.IsZero() {
+		categories = append(categories, greaderStarred)
+	}
+	for _, tag := range rec.Tags {
+		categories = append(categories, greaderLabelPrefix+tag)
+	}
+
+	return greaderItem{
+		ID:            greaderItemId(rec),
+		CrawlTimeMsec: strconv.FormatInt(rec.PublishedAt.UnixMilli(), 10),
+		TimestampUsec: strconv.FormatInt(rec.PublishedAt.UnixMicro(), 10),
+		Published:     rec.PublishedAt.Unix(),
+		Updated:       rec.PublishedAt.Unix(),
+		Title:         rec.Title,
+		Canonical:     []greaderLink{{Href: link}},
+		Alternate:     []greaderLink{{Href: link, Type: "text/html"}},
+		Summary:       greaderContent{Direction: "ltr", Content: string(recordHtml(rec))},
+		Categories:    categories,
+		Origin: greaderOrigin{
+			StreamID: greaderFeedPrefix + rec.FeedUrl,
+			Title:    rec.FeedSlug,
+			HtmlUrl:  rec.FeedUrl,
+		},
+	}
+}
+
+func (s *Server) sendGreaderItems(c *fiber.Ctx, streamId string, records []internal.Record, cont string) error {
+	items := make([]greaderItem, 0, len(records))
+	for _, rec := range records {
+		items = append(items, makeGreaderItem(rec))
+	}
+	res := fiber.Map{
+		"id":      streamId,
+		"updated": time.Now().Unix(),
+		"items":   items,
+	}
+	if cont != "" {
+		res["continuation"] = cont
+	}
+	return c.JSON(res)
+}
+
+func (s *Server) greaderStreamContents(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	streamId, err := url.PathUnescape(c.Params("*"))
+	if err != nil || streamId == "" {
+		streamId = greaderReadingList
+	}
+	filter, err := s.streamFilter(c, user, streamId)
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	records, err := s.db.GetRecords(filter)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get records",
+		})
+	}
+	return s.sendGreaderItems(c, streamId, records, continuation(records, filter))
+}
+
+func (s *Server) greaderItemIds(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	filter, err := s.streamFilter(c, user, c.Query("s", greaderReadingList))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	records, err := s.db.GetRecords(filter)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get records",
+		})
+	}
+
+	refs := make([]fiber.Map, 0, len(records))
+	for _, rec := range records {
+		refs = append(refs, fiber.Map{
+			"id":              strconv.FormatInt(rec.Num, 10),
+			"timestampUsec":   strconv.FormatInt(rec.PublishedAt.UnixMicro(), 10),
+			"directStreamIds": []string{},
+		})
+	}
+	res := fiber.Map{
+		"itemRefs": refs,
+	}
+	if cont := continuation(records, filter); cont != "" {
+		res["continuation"] = cont
+	}
+	return c.JSON(res)
+}
+
+// formValues returns all values of the parameter given in the query or
+// the form body, like the item ids i=...&i=...
+func formValues(c *fiber.Ctx, key string) []string {
+	var values []string
+	for _, v := range c.Context().QueryArgs().PeekMulti(key) {
+		values = append(values, string(v))
+	}
+	for _, v := range c.Context().PostArgs().PeekMulti(key) {
+		values = append(values, string(v))
+	}
+	return values
+}
+
+func itemNums(ids []string) ([]int64, error) {
+	nums := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		num, err := greaderItemNum(id)
+		if err != nil {
+			return nil, fmt.Errorf("bad item id %s", id)
+		}
+		nums = append(nums, num)
+	}
+	return nums, nil
+}
+
+func (s *Server) greaderItemContents(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	nums, err := itemNums(formValues(c, "i"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	records := make([]internal.Record, 0)
+	if len(nums) > 0 {
+		records, err = s.db.GetRecords(internal.RecordFilter{
+			UserID: user.ID,
+			Nums:   nums,
+			Limit:  len(nums),
+		})
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get records",
+			})
+		}
+	}
+	return s.sendGreaderItems(c, greaderReadingList, records, "")
+}
+
+// greaderEditTag adds (a=) and removes (r=) read and starred state of the
+// items (i=) for the user. Other tags are ignored.
+func (s *Server) greaderEditTag(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	nums, err := itemNums(formValues(c, "i"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(nums) == 0 {
+		return c.SendString("OK")
+	}
+	records, err := s.db.GetRecords(internal.RecordFilter{
+		UserID: user.ID,
+		Nums:   nums,
+		Limit:  len(nums),
+	})
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get records",
+		})
+	}
+
+	type edit struct {
+		state string
+		on    bool
+	}
+	var edits []edit
+	for _, tag := range formValues(c, "a") {
+		switch greaderStreamId(tag) {
+		case greaderRead:
+			edits = append(edits, edit{internal.RecordStateRead, true})
+		case greaderKeptUnread:
+			edits = append(edits, edit{internal.RecordStateRead, false})
+		case greaderStarred:
+			edits = append(edits, edit{internal.RecordStateStarred, true})
+		}
+	}
+	for _, tag := range formValues(c, "r") {
+		switch greaderStreamId(tag) {
+		case greaderRead:
+			edits = append(edits, edit{internal.RecordStateRead, false})
+		case greaderStarred:
+			edits = append(edits, edit{internal.RecordStateStarred, false})
+		}
+	}
+
+	for _, rec := range records {
+		for _, e := range edits {
+			err = s.db.SetUserRecordState(user.ID, rec.ID, e.state, e.on)
+			if err != nil {
+				return c.Status(500).JSON(&fiber.Map{
+					"error": "Failed to update record state",
+				})
+			}
+		}
+	}
+	return c.SendString("OK")
+}
+
+// greaderMarkAllRead marks records of the stream (s=) published before
+// the time (ts=, in microseconds) as read for the user.
+func (s *Server) greaderMarkAllRead(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	before := time.Now()
+	if ts, err := strconv.ParseInt(c.FormValue("ts"), 10, 64); err == nil && ts > 0 {
+		before = time.UnixMicro(ts)
+	}
+
+	var feeds []internal.Feed
+	var err error
+	switch id := greaderStreamId(c.FormValue("s")); {
+	case id == greaderReadingList:
+		feeds, err = s.db.GetSubscriptions(user.ID)
+	case strings.HasPrefix(id, greaderLabelPrefix):
+		var group internal.Group
+		group, err = s.db.GetGroupByName(strings.TrimPrefix(id, greaderLabelPrefix))
+		if err == nil {
+			feeds, err = s.db.GetGroupFeeds(group.ID)
+		}
+	case strings.HasPrefix(id, greaderFeedPrefix):
+		var feed internal.Feed
+		feed, err = s.db.FindFeedByUrl(strings.TrimPrefix(id, greaderFeedPrefix))
+		feeds = []internal.Feed{feed}
+	default:
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Unknown stream",
+		})
+	}
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Stream not found",
+		})
+	}
+
+	for _, feed := range feeds {
+		_, err = s.db.MarkUserFeedRead(user.ID, feed.ID, before)
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to mark records read",
+			})
+		}
+	}
+	return c.SendString("OK")
+}
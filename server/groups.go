@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/render"
+)
+
+// getAll merges records of every feed into one feed.
+func (s *Server) getAll(c *fiber.Ctx) error {
+	return s.sendRecords(c, s.baseUrl, "All feeds", "all", internal.RecordFilter{
+		Limit: c.QueryInt("limit", 100),
+	})
+}
+
+// getGroup merges records of feeds in the group into one feed.
+func (s *Server) getGroup(c *fiber.Ctx) error {
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad group name",
+		})
+	}
+	group, err := s.db.GetGroupByName(name)
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Group not found",
+		})
+	}
+
+	return s.sendRecords(c, s.baseUrl, group.Name, "group/"+url.PathEscape(group.Name), internal.RecordFilter{
+		GroupID: group.ID,
+		Limit:   c.QueryInt("limit", 100),
+	})
+}
+
+// sendRecords serves records of many feeds as one feed at the path of the
+// base URL.
+func (s *Server) sendRecords(c *fiber.Ctx, base string, title string, path string, filter internal.RecordFilter) error {
+	records, err := s.db.GetRecords(filter)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Records not found",
+		})
+	}
+
+	f := render.Feed{
+		Title:   title,
+		FeedUrl: fmt.Sprintf("%s/%s", base, path),
+	}
+	f.Items = aggregatedItems(base, records)
+	return s.sendFeed(c, &f)
+}
+
+// aggregatedItems makes items attributed to the feeds they came from.
+// A story told by several feeds is shown once, by its newest record, with
+// the other feeds listed in AlsoIn.
+func aggregatedItems(base string, records []internal.Record) []render.Item {
+	items := make([]render.Item, 0, len(records))
+	stories := map[string]int{}
+	for _, rec := range records {
+		source := render.Source{
+			Title:   rec.FeedSlug,
+			Url:     fmt.Sprintf("%s/feed/%s", base, rec.FeedSlug),
+			FeedUrl: rec.FeedUrl,
+		}
+
+		if i, ok := stories[rec.StoryID]; ok {
+			item := &items[i]
+			if !hasSource(item, source) {
+				item.AlsoIn = append(item.AlsoIn, source)
+			}
+			continue
+		}
+
+		item := recordItem(rec)
+		item.Source = &source
+		if rec.StoryID != "" {
+			stories[rec.StoryID] = len(items)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func hasSource(item *render.Item, source render.Source) bool {
+	if item.Source != nil && item.Source.Url == source.Url {
+		return true
+	}
+	for _, s := range item.AlsoIn {
+		if s.Url == source.Url {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+// groupStore knows groups without records. Other methods of the store
+// panic.
+type groupStore struct {
+	store.Store
+	groups map[string]internal.Group
+}
+
+func (m *groupStore) GetGroupByName(name string) (internal.Group, error) {
+	group, ok := m.groups[name]
+	if !ok {
+		return group, sql.ErrNoRows
+	}
+	return group, nil
+}
+
+func (m *groupStore) GetRecords(filter internal.RecordFilter) ([]internal.Record, error) {
+	return []internal.Record{}, nil
+}
+
+func TestGetGroupEscapedName(t *testing.T) {
+	db := &groupStore{groups: map[string]internal.Group{"Tech & news": {ID: "1", Name: "Tech & news"}}}
+	s := &Server{db: db, app: fiber.New(), baseUrl: "http://feeder"}
+	s.app.Get("/group/:name", s.getGroup)
+
+	res, err := s.app.Test(httptest.NewRequest("GET", "/group/Tech%20&%20news?format=rss", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Status = %d, want 200", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<link>http://feeder/group/Tech%20&amp;%20news</link>"
+	if !strings.Contains(string(body), want) {
+		t.Errorf("Feed %s has no %s", body, want)
+	}
+}
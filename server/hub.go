@@ -0,0 +1,457 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/events"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/render"
+	"github.com/tmshv/feeder/store"
+	"github.com/tmshv/feeder/websub"
+)
+
+const (
+	// hubDefaultLease is given to subscribers not asking for a lease.
+	hubDefaultLease = 7 * 24 * time.Hour
+	// hubDelay collects records added by a fetch into one push.
+	hubDelay = 5 * time.Second
+	// hubVerifications bounds verifications of callbacks running at once.
+	hubVerifications = 4
+	// hubHostInterval is the least time between verifications of
+	// callbacks on one host.
+	hubHostInterval = 10 * time.Second
+)
+
+// errTopicCredentials refuses topics with feed tokens, which would be
+// kept in plain text with subscriptions.
+var errTopicCredentials = errors.New("topics with credentials are not accepted")
+
+// errTopicKey refuses topics without the key of the feed.
+var errTopicKey = errors.New("wrong topic key")
+
+// hubSecretCheckpoint keeps the secret keys of topics are made of.
+const hubSecretCheckpoint = "hub:secret"
+
+// hubClient requests callbacks on public addresses only.
+var hubClient = websub.NewPublicClient(30 * time.Second)
+
+// hubLimiter rate limits verifications, which make the hub request URLs
+// given by anyone.
+type hubLimiter struct {
+	mu      sync.Mutex
+	running int
+	hosts   map[string]time.Time
+}
+
+func newHubLimiter() *hubLimiter {
+	return &hubLimiter{hosts: map[string]time.Time{}}
+}
+
+// acquire tells if a verification of a callback on the host may start.
+// Started verifications are released with release.
+func (l *hubLimiter) acquire(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for h, at := range l.hosts {
+		if now.Sub(at) >= hubHostInterval {
+			delete(l.hosts, h)
+		}
+	}
+	if _, ok := l.hosts[host]; ok || l.running >= hubVerifications {
+		return false
+	}
+	l.hosts[host] = now
+	l.running++
+	return true
+}
+
+func (l *hubLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+}
+
+// hubSecret is the secret of keys of topics. It is made on first use and
+// kept in the store, so topic URLs stay the same across restarts.
+type hubSecret struct {
+	mu    sync.Mutex
+	value []byte
+}
+
+func (h *hubSecret) load(db store.Store) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.value != nil {
+		return h.value, nil
+	}
+	value, err := db.GetCheckpoint(hubSecretCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		value, _, err = auth.NewToken()
+		if err != nil {
+			return nil, err
+		}
+		err = db.SetCheckpoint(hubSecretCheckpoint, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h.value = []byte(value)
+	return h.value, nil
+}
+
+// topicKey makes the key of the feed of the slug in the format. Feeds
+// served with authentication are pushed to subscribers given the key with
+// the topic URL by a reader of the feed. Feeds served to everyone have no
+// key.
+func (s *Server) topicKey(slug string, format string) string {
+	if s.noAuth {
+		return ""
+	}
+	secret, err := s.hubSecret.load(s.db)
+	if err != nil {
+		log.Printf("Failed to load hub secret: %v", err)
+		return ""
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(slug + "\n" + format))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// checkTopicKey tells if the key is the key of the feed in the format.
+func (s *Server) checkTopicKey(slug string, format string, key string) bool {
+	if s.noAuth {
+		return key == ""
+	}
+	want := s.topicKey(slug, format)
+	return want != "" && hmac.Equal([]byte(key), []byte(want))
+}
+
+// requireTopicReader lets in readers of the feed and subscribers of the
+// hub fetching its topic URL.
+func (s *Server) requireTopicReader(c *fiber.Ctx) error {
+	key := c.Query("key")
+	if key != "" && s.checkTopicKey(c.Params("slug"), c.Query("format"), key) {
+		return c.Next()
+	}
+	return s.requireReader(c)
+}
+
+func (s *Server) hubUrl() string {
+	return s.baseUrl + "/websub/hub"
+}
+
+// hubRoutes serves the WebSub hub of feeds served by feeder. Feeds link
+// to the hub, subscribers ask it to push feeds when they change.
+// Subscribers do not sign in, topics are authorized by their keys.
+func (s *Server) hubRoutes() {
+	s.app.Post("/websub/hub", s.hubSubscribe)
+}
+
+// hubSubscribe accepts subscription requests. The intent is verified
+// with the callback after the request is answered, as the spec asks.
+// Topics are feeds and saved searches at /feed/<slug> with the key of the
+// feed if authentication is on. Callbacks have to be on public addresses
+// and are verified a few at a time.
+func (s *Server) hubSubscribe(c *fiber.Ctx) error {
+	mode := c.FormValue("hub.mode")
+	if mode != "subscribe" && mode != "unsubscribe" {
+		return c.Status(400).SendString("Unknown hub.mode")
+	}
+	callback, err := url.Parse(c.FormValue("hub.callback"))
+	if err != nil {
+		return c.Status(400).SendString("hub.callback is not an absolute http(s) URL")
+	}
+	err = websub.CheckCallback(c.Context(), callback)
+	if err != nil {
+		return c.Status(400).SendString(fmt.Sprintf("Wrong hub.callback: %v", err))
+	}
+	secret := c.FormValue("hub.secret")
+	if len(secret) >= 200 {
+		return c.Status(400).SendString("hub.secret is too long")
+	}
+
+	slug, format, err := s.parseTopic(c.FormValue("hub.topic"))
+	if err == nil && mode == "subscribe" {
+		_, _, err = s.renderTopic(slug, format)
+	}
+	if err != nil {
+		return c.Status(400).SendString(fmt.Sprintf("Unknown hub.topic: %v", err))
+	}
+
+	seconds, _ := strconv.Atoi(c.FormValue("hub.lease_seconds"))
+	lease := time.Duration(seconds) * time.Second
+	if lease <= 0 {
+		lease = hubDefaultLease
+	}
+	if lease > websub.MaxLease {
+		lease = websub.MaxLease
+	}
+
+	if !s.hubLimit.acquire(callback.Hostname()) {
+		return c.Status(429).SendString("Too many requests, retry later")
+	}
+	go func() {
+		defer s.hubLimit.release()
+		s.hubVerify(mode, internal.HubSubscription{
+			Feed:      slug,
+			Format:    format,
+			Callback:  callback.String(),
+			Secret:    secret,
+			Lease:     int64(lease.Seconds()),
+			ExpiresAt: time.Now().Add(lease),
+		})
+	}()
+	return c.SendStatus(202)
+}
+
+// hubVerify saves or deletes the subscription if the callback confirms
+// the intent. Content of a new topic is remembered, so it is pushed
+// after it changes.
+func (s *Server) hubVerify(mode string, sub internal.HubSubscription) {
+	topic := s.topicUrl(sub.Feed, sub.Format)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := websub.VerifyIntent(ctx, hubClient, mode, websub.Request{
+		Hub:      s.hubUrl(),
+		Topic:    topic,
+		Callback: sub.Callback,
+		Secret:   sub.Secret,
+		Lease:    time.Duration(sub.Lease) * time.Second,
+	})
+	if err != nil {
+		log.Printf("Failed to verify %s of %s to %s: %v", mode, sub.Callback, topic, err)
+		return
+	}
+
+	if mode == "unsubscribe" {
+		err = s.db.DeleteHubSubscription(sub.Feed, sub.Format, sub.Callback)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Failed to delete hub subscription of %s: %v", sub.Callback, err)
+		}
+		log.Printf("Unsubscribed %s from %s", sub.Callback, topic)
+		return
+	}
+
+	err = s.db.SaveHubSubscription(sub)
+	if err != nil {
+		log.Printf("Failed to save hub subscription of %s: %v", sub.Callback, err)
+		return
+	}
+	log.Printf("Subscribed %s to %s for %ds", sub.Callback, topic, sub.Lease)
+
+	hash, err := s.db.GetCheckpoint(hubCheckpoint(sub.Feed, sub.Format))
+	if err == nil && hash == "" {
+		_, body, err := s.renderTopic(sub.Feed, sub.Format)
+		if err == nil {
+			err = s.db.SetCheckpoint(hubCheckpoint(sub.Feed, sub.Format), contentHash(body))
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to remember content of %s: %v", topic, err)
+	}
+}
+
+// parseTopic finds the slug and format of the feed of the topic URL.
+// Topics are feeds at /feed/<slug> with no query but the format and the
+// key. URLs with feed tokens, of private feeds or with a wrong key are
+// refused.
+func (s *Server) parseTopic(topic string) (string, string, error) {
+	path, ok := strings.CutPrefix(topic, s.baseUrl)
+	if !ok {
+		return "", "", errors.New("not a feed of the hub")
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	if query.Has("token") || strings.HasPrefix(u.Path, "/u/") {
+		return "", "", errTopicCredentials
+	}
+	slug, ok := strings.CutPrefix(u.Path, "/feed/")
+	if !ok || slug == "" || strings.Contains(slug, "/") {
+		return "", "", errors.New("not a feed of the hub")
+	}
+	for key := range query {
+		if key != "format" && key != "key" {
+			return "", "", fmt.Errorf("unknown parameter %s", key)
+		}
+	}
+	format := query.Get("format")
+	switch format {
+	case "", render.FormatJSON, render.FormatRSS, render.FormatAtom:
+	default:
+		return "", "", fmt.Errorf("unknown format %s", format)
+	}
+	if !s.checkTopicKey(slug, format, query.Get("key")) {
+		return "", "", errTopicKey
+	}
+	return slug, format, nil
+}
+
+// topicUrl makes the topic URL of the feed in the format.
+func (s *Server) topicUrl(slug string, format string) string {
+	topic := fmt.Sprintf("%s/feed/%s", s.baseUrl, url.PathEscape(slug))
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if key := s.topicKey(slug, format); key != "" {
+		query.Set("key", key)
+	}
+	if len(query) > 0 {
+		topic += "?" + query.Encode()
+	}
+	return topic
+}
+
+// advertiseHub links the feed of the slug to the hub with its topic URL
+// as self. Only feeds the hub accepts as topics are linked to it.
+func (s *Server) advertiseHub(f *render.Feed, slug string, format string) {
+	f.SelfUrl = s.topicUrl(slug, format)
+	f.HubUrl = s.hubUrl()
+}
+
+// renderTopic renders the feed or saved search of the slug in the format.
+// It returns the content type and the content.
+func (s *Server) renderTopic(slug string, format string) (string, []byte, error) {
+	var f render.Feed
+	feed, err := s.db.GetFeedBySlug(slug)
+	if err == nil {
+		f, err = s.feedOf(feed)
+	} else {
+		var saved internal.SavedSearch
+		saved, err = s.db.GetSavedSearchBySlug(slug)
+		if err == nil {
+			f, err = s.savedSearchFeed(saved, 100)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.advertiseHub(&f, slug, format)
+	data, err := render.Render(&f, format)
+	if err != nil {
+		return "", nil, err
+	}
+	return render.ContentType(format), data, nil
+}
+
+func hubCheckpoint(slug string, format string) string {
+	return fmt.Sprintf("hub:%s:%s", slug, format)
+}
+
+func contentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// runHub pushes changed topics to subscribers when records are added or
+// pages extracted. Events coming within hubDelay are pushed together.
+func (s *Server) runHub(sub *events.Subscription) {
+	timer := time.NewTimer(hubDelay)
+	timer.Stop()
+	pending := false
+	for {
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !pending {
+				timer.Reset(hubDelay)
+				pending = true
+			}
+		case <-timer.C:
+			pending = false
+			s.publishTopics()
+		}
+	}
+}
+
+// publishTopics pushes every subscribed topic with content changed since
+// the last push. Subscribers answering 410 are unsubscribed.
+func (s *Server) publishTopics() {
+	n, err := s.db.DeleteExpiredHubSubscriptions(time.Now())
+	if err != nil {
+		log.Printf("Failed to delete expired hub subscriptions: %v", err)
+	}
+	if n > 0 {
+		log.Printf("Deleted %d expired hub subscriptions", n)
+	}
+
+	subs, err := s.db.GetHubSubscriptions()
+	if err != nil {
+		log.Printf("Failed to get hub subscriptions: %v", err)
+		return
+	}
+	type key struct{ feed, format string }
+	topics := map[key][]internal.HubSubscription{}
+	for _, sub := range subs {
+		k := key{sub.Feed, sub.Format}
+		topics[k] = append(topics[k], sub)
+	}
+
+	for k, subs := range topics {
+		topic := s.topicUrl(k.feed, k.format)
+		contentType, body, err := s.renderTopic(k.feed, k.format)
+		if err != nil {
+			log.Printf("Failed to render topic %s: %v", topic, err)
+			continue
+		}
+		hash := contentHash(body)
+		last, err := s.db.GetCheckpoint(hubCheckpoint(k.feed, k.format))
+		if err != nil {
+			log.Printf("Failed to get content hash of %s: %v", topic, err)
+			continue
+		}
+		if hash == last {
+			continue
+		}
+
+		for _, sub := range subs {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			err = websub.Publish(ctx, hubClient, websub.Request{
+				Hub:      s.hubUrl(),
+				Topic:    topic,
+				Callback: sub.Callback,
+				Secret:   sub.Secret,
+			}, contentType, body)
+			cancel()
+			switch {
+			case errors.Is(err, websub.ErrGone):
+				log.Printf("Unsubscribed %s gone from %s", sub.Callback, topic)
+				err = s.db.DeleteHubSubscription(sub.Feed, sub.Format, sub.Callback)
+				if err != nil {
+					log.Printf("Failed to delete hub subscription of %s: %v", sub.Callback, err)
+				}
+			case err != nil:
+				log.Printf("Failed to push %s to %s: %v", topic, sub.Callback, err)
+			}
+		}
+
+		err = s.db.SetCheckpoint(hubCheckpoint(k.feed, k.format), hash)
+		if err != nil {
+			log.Printf("Failed to save content hash of %s: %v", topic, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+// hubStore serves one feed of one record, in every group, to users of
+// authStore.
+type hubStore struct {
+	*authStore
+	checkpoints map[string]string
+}
+
+func newHubStore(t *testing.T) *hubStore {
+	return &hubStore{authStore: newAuthStore(t), checkpoints: map[string]string{}}
+}
+
+func (m *hubStore) GetCheckpoint(name string) (string, error) {
+	return m.checkpoints[name], nil
+}
+
+func (m *hubStore) SetCheckpoint(name string, value string) error {
+	m.checkpoints[name] = value
+	return nil
+}
+
+func (m *hubStore) GetFeedBySlug(slug string) (internal.Feed, error) {
+	if slug != "news" {
+		return internal.Feed{}, sql.ErrNoRows
+	}
+	return internal.Feed{ID: "1", Slug: "news"}, nil
+}
+
+func (m *hubStore) GetSavedSearchBySlug(slug string) (internal.SavedSearch, error) {
+	return internal.SavedSearch{}, sql.ErrNoRows
+}
+
+func (m *hubStore) GetGroupByName(name string) (internal.Group, error) {
+	return internal.Group{ID: "1", Name: name}, nil
+}
+
+func (m *hubStore) GetFeedModifiedAt(feedID string) (time.Time, error) {
+	return time.Now(), nil
+}
+
+func (m *hubStore) GetFeedRecords(feedID string, withPages bool) ([]internal.Record, error) {
+	return m.GetRecords(internal.RecordFilter{})
+}
+
+func (m *hubStore) GetRecords(filter internal.RecordFilter) ([]internal.Record, error) {
+	return []internal.Record{{ID: "a", FeedID: "1", FeedSlug: "news", Title: "News", Link: "https://example.com/a"}}, nil
+}
+
+func TestHubLinks(t *testing.T) {
+	tests := []struct {
+		target string
+		// self is the topic URL of the feed without its key.
+		self string
+	}{
+		{target: "/feed/news?token=alice-feed", self: "http://feeder/feed/news"},
+		{target: "/feed/news?format=rss&limit=5&token=alice-feed", self: "http://feeder/feed/news?format=rss"},
+		{target: "/all?token=alice-feed"},
+		{target: "/group/tech?token=alice-feed"},
+		{target: "/unread?token=alice-feed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			s := New(newHubStore(t), nil, nil, "http://feeder", false)
+
+			res, err := s.app.Test(httptest.NewRequest("GET", tt.target, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != 200 {
+				t.Fatalf("Status = %d, want 200", res.StatusCode)
+			}
+			want := ""
+			if tt.self != "" {
+				format := ""
+				if strings.Contains(tt.self, "format=rss") {
+					format = "rss"
+				}
+				want = fmt.Sprintf(`<http://feeder/websub/hub>; rel="hub", <%s>; rel="self"`, s.topicUrl("news", format))
+				if !strings.HasPrefix(s.topicUrl("news", format), tt.self) {
+					t.Errorf("Topic URL %s is not of %s", s.topicUrl("news", format), tt.self)
+				}
+			}
+			if link := res.Header.Get("Link"); link != want {
+				t.Errorf("Link = %q, want %q", link, want)
+			}
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(body), "alice-feed") {
+				t.Errorf("Feed %s has the feed token", body)
+			}
+			if hub := strings.Contains(string(body), "/websub/hub"); hub != (want != "") {
+				t.Errorf("Feed %s links to the hub: %v", body, hub)
+			}
+		})
+	}
+}
+
+func TestTopicKey(t *testing.T) {
+	s := New(newHubStore(t), nil, nil, "http://feeder", false)
+	topic := s.topicUrl("news", "rss")
+	if !strings.Contains(topic, "key=") {
+		t.Fatalf("Topic URL %s has no key", topic)
+	}
+
+	tests := []struct {
+		topic string
+		err   bool
+	}{
+		{topic: topic},
+		{topic: s.topicUrl("news", "")},
+		{topic: "http://feeder/feed/news?format=rss", err: true},
+		{topic: "http://feeder/feed/news?format=atom&" + topic[strings.Index(topic, "key="):], err: true},
+		{topic: strings.Replace(topic, "/news", "/blog", 1), err: true},
+		{topic: topic + "&token=alice-feed", err: true},
+	}
+	for _, tt := range tests {
+		_, _, err := s.parseTopic(tt.topic)
+		if (err != nil) != tt.err {
+			t.Errorf("parseTopic(%s) = %v, want error %v", tt.topic, err, tt.err)
+		}
+	}
+
+	// Subscribers fetch the topic without credentials.
+	path := strings.TrimPrefix(topic, "http://feeder")
+	for target, want := range map[string]int{
+		path:                             200,
+		"/feed/news?format=rss":          401,
+		"/feed/news?format=rss&key=0123": 401,
+	} {
+		res, err := s.app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", target, res.StatusCode, want)
+		}
+	}
+
+	// The hub takes requests of subscribers without credentials.
+	res, err := s.app.Test(httptest.NewRequest("POST", "/websub/hub", strings.NewReader("hub.mode=x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 400 {
+		t.Errorf("POST /websub/hub = %d, want 400", res.StatusCode)
+	}
+
+	// The secret of keys is kept across restarts.
+	again := New(s.db, nil, nil, "http://feeder", false)
+	if again.topicUrl("news", "rss") != topic {
+		t.Errorf("Topic URL %s changed to %s", topic, again.topicUrl("news", "rss"))
+	}
+}
+
+func TestTopicKeyWithoutAuth(t *testing.T) {
+	s := New(newHubStore(t), nil, nil, "http://feeder", true)
+	if topic := s.topicUrl("news", "rss"); topic != "http://feeder/feed/news?format=rss" {
+		t.Errorf("Topic URL = %s, want no key", topic)
+	}
+	_, _, err := s.parseTopic("http://feeder/feed/news?format=rss")
+	if err != nil {
+		t.Error(err)
+	}
+}
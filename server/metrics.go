@@ -0,0 +1,42 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tmshv/feeder/metrics"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// metricsRoutes serve Prometheus metrics to admins.
+func (s *Server) metricsRoutes() {
+	handler := fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())
+	s.app.Get("/metrics", s.requireAdmin, func(c *fiber.Ctx) error {
+		handler(c.Context())
+		return nil
+	})
+}
+
+// observeRequest measures the time to handle the request by route
+// pattern, so records and feeds of paths are not told apart. The method
+// is copied as fiber reuses its memory.
+func observeRequest(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+	}
+	metrics.RequestDuration.WithLabelValues(
+		strings.Clone(c.Method()),
+		c.Route().Path,
+		strconv.Itoa(status),
+	).Observe(time.Since(start).Seconds())
+	return err
+}
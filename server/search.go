@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/render"
+)
+
+// getSearch answers full-text queries as a feed. Matched words are
+// highlighted with <mark> in the content_html snippet of every item.
+func (s *Server) getSearch(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Query is empty",
+		})
+	}
+
+	filter := internal.SearchFilter{
+		Limit: c.QueryInt("limit", 50),
+	}
+	if slug := c.Query("feed"); slug != "" {
+		feed, err := s.db.GetFeedBySlug(slug)
+		if err != nil {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Feed not found",
+			})
+		}
+		filter.FeedIDs = []string{feed.ID}
+	}
+
+	results, err := s.db.Search(query, filter)
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": fmt.Sprintf("Bad query: %v", err),
+		})
+	}
+
+	f := render.Feed{
+		Title:   fmt.Sprintf("Search: %s", query),
+		FeedUrl: fmt.Sprintf("%s/search?q=%s", s.baseUrl, url.QueryEscape(query)),
+	}
+	f.Items = searchItems(results)
+	return s.sendFeed(c, &f)
+}
+
+func (s *Server) sendSavedSearch(c *fiber.Ctx, saved internal.SavedSearch) error {
+	f, err := s.savedSearchFeed(saved, c.QueryInt("limit", 100))
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": fmt.Sprintf("Saved search failed: %v", err),
+		})
+	}
+	s.advertiseHub(&f, saved.Slug, c.Query("format"))
+	return s.sendFeed(c, &f)
+}
+
+// savedSearchFeed makes the feed of the newest results of the saved
+// search.
+func (s *Server) savedSearchFeed(saved internal.SavedSearch, limit int) (render.Feed, error) {
+	filter := saved.Filter(time.Now())
+	filter.Newest = true
+	filter.Limit = limit
+
+	results, err := s.db.Search(saved.Query, filter)
+	if err != nil {
+		return render.Feed{}, err
+	}
+
+	title := saved.Title
+	if title == "" {
+		title = saved.Slug
+	}
+	f := render.Feed{
+		Title:       title,
+		Description: fmt.Sprintf("Saved search: %s", saved.Query),
+		FeedUrl:     fmt.Sprintf("%s/feed/%s", s.baseUrl, saved.Slug),
+	}
+	f.Items = searchItems(results)
+	return f, nil
+}
+
+func searchItems(results []internal.SearchResult) []render.Item {
+	items := make([]render.Item, 0, len(results))
+	for _, res := range results {
+		item := recordItem(res.Record)
+		item.ContentHtml = res.Snippet
+		items = append(items, item)
+	}
+	return items
+}
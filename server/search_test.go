@@ -0,0 +1,111 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+// searchStore knows feeds and searches them. Other methods of the store
+// panic.
+type searchStore struct {
+	store.Store
+	feeds   map[string]internal.Feed
+	results []internal.SearchResult
+	err     error
+
+	query  string
+	filter internal.SearchFilter
+}
+
+func (m *searchStore) GetFeedBySlug(slug string) (internal.Feed, error) {
+	feed, ok := m.feeds[slug]
+	if !ok {
+		return feed, sql.ErrNoRows
+	}
+	return feed, nil
+}
+
+func (m *searchStore) Search(query string, filter internal.SearchFilter) ([]internal.SearchResult, error) {
+	m.query = query
+	m.filter = filter
+	return m.results, m.err
+}
+
+func TestGetSearch(t *testing.T) {
+	db := &searchStore{
+		feeds: map[string]internal.Feed{"news": {ID: "1", Slug: "news"}},
+		results: []internal.SearchResult{{
+			Record:  internal.Record{ID: "a", Title: "Rust release", Link: "https://example.com/a"},
+			Snippet: "<mark>Rust</mark> release",
+		}},
+	}
+	s := &Server{db: db, app: fiber.New(), baseUrl: "http://feeder"}
+	s.app.Get("/search", s.getSearch)
+
+	res, err := s.app.Test(httptest.NewRequest("GET", "/search?q=+rust+&feed=news&limit=5", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Status = %d, want 200", res.StatusCode)
+	}
+	if db.query != "rust" {
+		t.Errorf("Searched %q, want %q", db.query, "rust")
+	}
+	if len(db.filter.FeedIDs) != 1 || db.filter.FeedIDs[0] != "1" || db.filter.Limit != 5 {
+		t.Errorf("Searched with %+v, want feed 1 and limit 5", db.filter)
+	}
+
+	var feed struct {
+		Title string `json:"title"`
+		Items []struct {
+			ID          string `json:"id"`
+			ContentHTML string `json:"content_html"`
+		} `json:"items"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Search: rust" {
+		t.Errorf("Title = %q, want %q", feed.Title, "Search: rust")
+	}
+	if len(feed.Items) != 1 || feed.Items[0].ID != "a" || feed.Items[0].ContentHTML != "<mark>Rust</mark> release" {
+		t.Errorf("Items = %+v, want the result with its snippet", feed.Items)
+	}
+}
+
+func TestGetSearchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		err    error
+		want   int
+	}{
+		{name: "empty query", target: "/search?q=+", want: 400},
+		{name: "unknown feed", target: "/search?q=rust&feed=blog", want: 404},
+		{name: "bad query", target: "/search?q=%22rust", err: errors.New("fts5: syntax error"), want: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &searchStore{feeds: map[string]internal.Feed{"news": {ID: "1"}}, err: tt.err}
+			s := &Server{db: db, app: fiber.New()}
+			s.app.Get("/search", s.getSearch)
+
+			res, err := s.app.Test(httptest.NewRequest("GET", tt.target, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("Status = %d, want %d", res.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/tmshv/feeder/events"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/render"
+	"github.com/tmshv/feeder/store"
+)
+
+// Runner fetches feeds in the background.
+type Runner interface {
+	// Start fetches the feed periodically, restarting it if it runs.
+	Start(internal.Feed)
+	Stop(string)
+	// Refresh fetches the running feed now.
+	Refresh(string) bool
+	// Push adds records of the feed content pushed by a WebSub hub.
+	Push(internal.Feed, []byte) error
+}
+
+type Server struct {
+	db     store.Store
+	runner Runner
+	bus    *events.Bus
+	app    *fiber.App
+	cache  *feedCache
+	// hubLimit rate limits verifications of hub subscribers.
+	hubLimit *hubLimiter
+	// hubSecret makes keys of topics, loaded on first use.
+	hubSecret hubSecret
+	baseUrl   string
+	// noAuth serves feeds and mutation endpoints to anonymous requests.
+	noAuth bool
+}
+
+func (s *Server) Listen(addr string) error {
+	return s.app.Listen(addr)
+}
+
+func (s *Server) routes() {
+	s.app.Use(recover.New())
+	s.app.Use(observeRequest)
+	s.app.Use(s.authenticate)
+
+	s.app.Get("/feed/:slug", s.requireTopicReader, s.getFeed)
+	s.app.Get("/all", s.requireReader, s.getAll)
+	s.app.Get("/group/:name", s.requireReader, s.getGroup)
+	s.app.Get("/search", s.requireReader, s.getSearch)
+	s.app.Get("/unread", s.requireReader, s.getUnread)
+	s.app.Get("/starred", s.requireReader, s.getStarred)
+	s.app.Get("/events", s.requireReader, s.getEvents)
+
+	// State of records shared by everyone is seen without authentication
+	// only. Signed in users change their own state at /api/me.
+	if s.noAuth {
+		s.app.Post("/api/records/:id/:state", s.requireAdmin, s.setRecordState(true))
+		s.app.Delete("/api/records/:id/:state", s.requireAdmin, s.setRecordState(false))
+		s.app.Post("/api/feeds/:slug/read", s.requireAdmin, s.markFeedRead)
+	}
+
+	s.app.Post("/api/me/records/:id/:state", s.requireUser, s.setUserRecordState(true))
+	s.app.Delete("/api/me/records/:id/:state", s.requireUser, s.setUserRecordState(false))
+	s.app.Post("/api/me/feeds/:slug/read", s.requireUser, s.markUserFeedRead)
+
+	s.apiRoutes()
+	s.greaderRoutes()
+	s.feverRoutes()
+	s.websubRoutes()
+	s.hubRoutes()
+	s.uiRoutes()
+	s.metricsRoutes()
+
+	s.privateRoutes()
+}
+
+// getFeed serves a feed by slug. The slug is looked up among real feeds
+// first and among saved searches then. Real feeds are validated by the
+// time their newest record or page was added and kept rendered until
+// records are added to them.
+func (s *Server) getFeed(c *fiber.Ctx) error {
+	if entry, ok := s.cache.get(c.OriginalURL()); ok {
+		return s.sendCachedFeed(c, entry)
+	}
+
+	slug := c.Params("slug")
+	version := s.cache.version(slug)
+	feed, err := s.db.GetFeedBySlug(slug)
+	if err != nil {
+		saved, err := s.db.GetSavedSearchBySlug(slug)
+		if err != nil {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Feed not found",
+			})
+		}
+		return s.sendSavedSearch(c, saved)
+	}
+
+	modifiedAt, err := s.db.GetFeedModifiedAt(feed.ID)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get feed",
+		})
+	}
+	if feed.UpdatedAt.After(modifiedAt) {
+		modifiedAt = feed.UpdatedAt
+	}
+	etag := feedEtag(modifiedAt, c.Query("format", render.FormatJSON))
+	if notModified(c, etag, modifiedAt) {
+		s.setValidators(c, etag, modifiedAt)
+		return c.SendStatus(304)
+	}
+
+	f, err := s.feedOf(feed)
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Records not found",
+		})
+	}
+	s.advertiseHub(&f, feed.Slug, c.Query("format"))
+	contentType, data, err := s.renderFeed(c, &f)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to render feed",
+		})
+	}
+
+	entry := &cachedFeed{
+		slug:        feed.Slug,
+		contentType: contentType,
+		link:        hubLink(&f),
+		body:        data,
+		etag:        etag,
+		modifiedAt:  modifiedAt,
+	}
+	s.cache.put(c.OriginalURL(), entry, version)
+	return s.sendCachedFeed(c, entry)
+}
+
+// feedOf makes the feed of records of the real feed.
+func (s *Server) feedOf(feed internal.Feed) (render.Feed, error) {
+	records, err := s.db.GetFeedRecords(feed.ID, true)
+	if err != nil {
+		return render.Feed{}, err
+	}
+
+	f := render.Feed{
+		Title:   feed.Slug,
+		FeedUrl: fmt.Sprintf("%s/feed/%s", s.baseUrl, feed.Slug),
+		Items:   make([]render.Item, 0, len(records)),
+	}
+	for _, rec := range records {
+		f.Items = append(f.Items, recordItem(rec))
+	}
+	return f, nil
+}
+
+// renderFeed renders the feed in the format asked with the format query
+// parameter, JSON Feed by default. It returns the content type and the
+// content.
+func (s *Server) renderFeed(c *fiber.Ctx, f *render.Feed) (string, []byte, error) {
+	format := c.Query("format", render.FormatJSON)
+	data, err := render.Render(f, format)
+	if err != nil {
+		return "", nil, err
+	}
+	return render.ContentType(format), data, nil
+}
+
+// sendFeed writes the rendered feed.
+func (s *Server) sendFeed(c *fiber.Ctx, f *render.Feed) error {
+	contentType, data, err := s.renderFeed(c, f)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to render feed",
+		})
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	if link := hubLink(f); link != "" {
+		c.Set(fiber.HeaderLink, link)
+	}
+	return c.Send(data)
+}
+
+// hubLink makes the Link header of the WebSub hub and topic of the feed.
+// Feeds the hub does not push have none.
+func hubLink(f *render.Feed) string {
+	if f.HubUrl == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, f.HubUrl, f.SelfUrl)
+}
+
+func recordItem(rec internal.Record) render.Item {
+	link := rec.Link
+	if rec.CanonicalLink != "" {
+		link = rec.CanonicalLink
+	}
+	return render.Item{
+		ID:          rec.ID,
+		Url:         link,
+		Title:       rec.Title,
+		ContentText: rec.Content,
+		Summary:     rec.Description,
+		PublishedAt: rec.PublishedAt,
+		Tags:        rec.Tags,
+	}
+}
+
+// New makes a server of feeds at the base URL. Feeds changed through the
+// API are restarted with the runner. Events of the bus are streamed to
+// clients and feeds changed by them are pushed to WebSub subscribers.
+// Requests are authenticated unless noAuth is set.
+func New(db store.Store, runner Runner, bus *events.Bus, baseUrl string, noAuth bool) *Server {
+	s := Server{
+		db:       db,
+		runner:   runner,
+		bus:      bus,
+		app:      fiber.New(),
+		hubLimit: newHubLimiter(),
+		baseUrl:  baseUrl,
+		noAuth:   noAuth,
+	}
+	s.routes()
+	if bus != nil {
+		s.cache = newFeedCache()
+		bus.Hook(s.invalidateCache)
+		go s.runHub(bus.Subscribe(events.Filter{
+			Types: []string{events.RecordCreated, events.PageExtracted},
+		}, 0))
+	}
+	return &s
+}
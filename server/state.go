@@ -0,0 +1,169 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/internal"
+)
+
+// setRecordState makes a handler turning the record state shared by
+// everyone on or off. The state is read, star or archive. The updated
+// record is sent back. It is served without authentication only.
+func (s *Server) setRecordState(on bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		var err error
+		switch c.Params("state") {
+		case "read":
+			err = s.db.SetRecordRead(id, on)
+		case "star":
+			err = s.db.SetRecordStarred(id, on)
+		case "archive":
+			err = s.db.SetRecordArchived(id, on)
+		default:
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Unknown state",
+			})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Record not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to update record",
+			})
+		}
+
+		rec, err := s.db.GetRecord(id)
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to get record",
+			})
+		}
+		return c.JSON(rec)
+	}
+}
+
+// recordStates maps states of URLs to states of records.
+var recordStates = map[string]string{
+	"read":    internal.RecordStateRead,
+	"star":    internal.RecordStateStarred,
+	"archive": internal.RecordStateArchived,
+}
+
+// setUserRecordState makes a handler turning the state of the record for
+// the signed in user on or off.
+func (s *Server) setUserRecordState(on bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, _ := currentUser(c)
+		id := c.Params("id")
+		state, ok := recordStates[c.Params("state")]
+		if !ok {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Unknown state",
+			})
+		}
+
+		err := s.db.SetUserRecordState(user.ID, id, state, on)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(&fiber.Map{
+				"error": "Record not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(&fiber.Map{
+				"error": "Failed to update record",
+			})
+		}
+		return c.JSON(&fiber.Map{
+			"id":    id,
+			"state": state,
+			"value": on,
+		})
+	}
+}
+
+// parseTime reads a query parameter given as a date or RFC 3339 time. Zero
+// time is returned if it is not given.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// markFeedRead marks records of the feed published before the time given
+// with the before query parameter as read for everyone. It is served
+// without authentication only, markUserFeedRead marks them for the signed
+// in user.
+func (s *Server) markFeedRead(c *fiber.Ctx) error {
+	return s.markRead(c, false)
+}
+
+func (s *Server) markUserFeedRead(c *fiber.Ctx) error {
+	return s.markRead(c, true)
+}
+
+func (s *Server) markRead(c *fiber.Ctx, forUser bool) error {
+	feed, err := s.findFeed(c.Params("slug"))
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+	before, err := parseTime(c.Query("before"))
+	if err != nil {
+		return c.Status(400).JSON(&fiber.Map{
+			"error": "Bad before, use 2006-01-02 or RFC 3339",
+		})
+	}
+	if before.IsZero() {
+		before = time.Now()
+	}
+
+	var n int64
+	if forUser {
+		user, _ := currentUser(c)
+		n, err = s.db.MarkUserFeedRead(user.ID, feed.ID, before)
+	} else {
+		n, err = s.db.MarkFeedRead(feed.ID, before)
+	}
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to update records",
+		})
+	}
+	return c.JSON(&fiber.Map{
+		"updated": n,
+	})
+}
+
+// getUnread serves records neither read nor archived. Signed in users get
+// records of their subscriptions in their read state.
+func (s *Server) getUnread(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	return s.sendRecords(c, s.baseUrl, "Unread", "unread", internal.RecordFilter{
+		UserID: user.ID,
+		Unread: true,
+		Limit:  c.QueryInt("limit", 100),
+	})
+}
+
+// getStarred serves starred records, of the signed in user if any.
+func (s *Server) getStarred(c *fiber.Ctx) error {
+	user, _ := currentUser(c)
+	return s.sendRecords(c, s.baseUrl, "Starred", "starred", internal.RecordFilter{
+		UserID:  user.ID,
+		Starred: true,
+		Limit:   c.QueryInt("limit", 100),
+	})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+// stateStore keeps read state of records shared by everyone on top of
+// users of authStore.
+type stateStore struct {
+	*authStore
+	records map[string]internal.Record
+	feeds   map[string]internal.Feed
+}
+
+func (m *stateStore) GetRecord(id string) (internal.Record, error) {
+	rec, ok := m.records[id]
+	if !ok {
+		return rec, sql.ErrNoRows
+	}
+	return rec, nil
+}
+
+func (m *stateStore) SetRecordRead(id string, read bool) error {
+	rec, ok := m.records[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	rec.ReadAt = time.Time{}
+	if read {
+		rec.ReadAt = time.Now()
+	}
+	m.records[id] = rec
+	return nil
+}
+
+func (m *stateStore) GetFeedByID(id string) (internal.Feed, error) {
+	return internal.Feed{}, sql.ErrNoRows
+}
+
+func (m *stateStore) GetFeedBySlug(slug string) (internal.Feed, error) {
+	feed, ok := m.feeds[slug]
+	if !ok {
+		return feed, sql.ErrNoRows
+	}
+	return feed, nil
+}
+
+func (m *stateStore) MarkFeedRead(feedID string, before time.Time) (int64, error) {
+	var n int64
+	for id, rec := range m.records {
+		if rec.FeedID == feedID && rec.ReadAt.IsZero() {
+			rec.ReadAt = time.Now()
+			m.records[id] = rec
+			n += 1
+		}
+	}
+	return n, nil
+}
+
+func TestSharedRecordStateWithoutAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		noAuth bool
+		header string
+		want   int
+		read   bool
+	}{
+		{name: "without auth", noAuth: true, want: 200, read: true},
+		{name: "admin", header: "Bearer bob-api", want: 404},
+		{name: "user", header: "Bearer alice-api", want: 404},
+	}
+	for _, tt := range tests {
+		for _, target := range []string{"/api/records/a/read", "/api/feeds/news/read"} {
+			t.Run(tt.name+" "+target, func(t *testing.T) {
+				db := &stateStore{
+					authStore: newAuthStore(t),
+					records:   map[string]internal.Record{"a": {ID: "a", FeedID: "1"}},
+					feeds:     map[string]internal.Feed{"news": {ID: "1", Slug: "news"}},
+				}
+				s := New(db, nil, nil, "http://feeder", tt.noAuth)
+
+				req := httptest.NewRequest("POST", target, nil)
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				res, err := s.app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.StatusCode != tt.want {
+					t.Errorf("Status = %d, want %d", res.StatusCode, tt.want)
+				}
+				if read := !db.records["a"].ReadAt.IsZero(); read != tt.read {
+					t.Errorf("Record read = %v, want %v", read, tt.read)
+				}
+			})
+		}
+	}
+}
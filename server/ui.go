@@ -0,0 +1,366 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/tmshv/feeder/internal"
+	"github.com/yuin/goldmark"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var uiFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("2 Jan 2006 15:04")
+	},
+}
+
+// feedHtmlPolicy keeps markup of feed content safe to show on pages of
+// the UI: no scripts, styles, frames or event handlers.
+var feedHtmlPolicy = bluemonday.UGCPolicy()
+
+var (
+	listTemplate    = parseTemplate("list.html")
+	articleTemplate = parseTemplate("article.html")
+)
+
+// parseTemplate parses the page template with the layout it is shown in.
+func parseTemplate(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(uiFuncs).ParseFS(templateFiles, "templates/layout.html", "templates/"+name))
+}
+
+// uiFeed is a feed of the sidebar.
+type uiFeed struct {
+	Slug   string
+	Unread int
+	Active bool
+}
+
+// uiPage is data of pages of the UI.
+type uiPage struct {
+	Title string
+	Feeds []uiFeed
+	// CanWrite shows forms changing feeds and records.
+	CanWrite bool
+	Error    string
+
+	Feed    *internal.Feed
+	Records []internal.Record
+	Unread  bool
+
+	Record  *internal.Record
+	Content template.HTML
+}
+
+// uiRoutes serve the reading UI: feeds with unread counts, records of
+// feeds and articles made of extracted pages.
+func (s *Server) uiRoutes() {
+	s.app.Get("/", s.requireReader, s.uiAll)
+	s.app.Get("/ui/feed/:slug", s.requireReader, s.uiFeed)
+	s.app.Get("/ui/records/:id", s.requireReader, s.uiRecord)
+	s.app.Post("/ui/records/:id/read", s.sameOrigin, s.requireReader, s.uiMarkRead)
+	s.app.Post("/ui/records/:id/unread", s.sameOrigin, s.requireReader, s.uiMarkUnread)
+	s.app.Post("/ui/feeds", s.sameOrigin, s.requireReader, s.uiAddFeed)
+	s.app.Post("/ui/feeds/:slug/delete", s.sameOrigin, s.requireReader, s.uiDeleteFeed)
+}
+
+// sameOrigin refuses form posts of other sites, which would be sent with
+// the session cookie of the user. The post must come from a page of the
+// host it is sent to or of the base URL, as told by the Origin header or
+// by the Referer header if browsers leave the origin out.
+func (s *Server) sameOrigin(c *fiber.Ctx) error {
+	source := c.Get(fiber.HeaderOrigin)
+	if source == "" || source == "null" {
+		source = c.Get(fiber.HeaderReferer)
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return c.Status(403).SendString("Cross-site request refused")
+	}
+	if u.Host == c.Hostname() {
+		return c.Next()
+	}
+	base, err := url.Parse(s.baseUrl)
+	if err == nil && u.Scheme == base.Scheme && u.Host == base.Host {
+		return c.Next()
+	}
+	return c.Status(403).SendString("Cross-site request refused")
+}
+
+// canWrite tells if the request may change feeds and records: users
+// signed in with a password or an API token, anyone if authentication is
+// off.
+func (s *Server) canWrite(c *fiber.Ctx) bool {
+	if c.Locals("readOnly") != nil {
+		return false
+	}
+	_, ok := currentUser(c)
+	return ok || s.noAuth
+}
+
+// newPage makes data of a page with the sidebar. Signed in users see
+// their subscriptions, everyone else sees all feeds.
+func (s *Server) newPage(c *fiber.Ctx, title string, active string) (uiPage, error) {
+	page := uiPage{
+		Title:    title,
+		CanWrite: s.canWrite(c),
+		Error:    c.Query("error"),
+	}
+
+	user, ok := currentUser(c)
+	var feeds []internal.Feed
+	var err error
+	if ok {
+		feeds, err = s.db.GetSubscriptions(user.ID)
+	} else {
+		feeds, err = s.db.GetFeeds()
+	}
+	if err != nil {
+		return page, err
+	}
+	counts, err := s.db.CountRecordsByFeed(internal.RecordFilter{
+		UserID: user.ID,
+		Unread: true,
+	})
+	if err != nil {
+		return page, err
+	}
+
+	for _, feed := range feeds {
+		page.Feeds = append(page.Feeds, uiFeed{
+			Slug:   feed.Slug,
+			Unread: counts[feed.ID],
+			Active: feed.Slug == active,
+		})
+	}
+	return page, nil
+}
+
+func sendPage(c *fiber.Ctx, tmpl *template.Template, page uiPage) error {
+	var buf bytes.Buffer
+	err := tmpl.ExecuteTemplate(&buf, "layout", page)
+	if err != nil {
+		log.Printf("Failed to render page %s: %v", tmpl.Name(), err)
+		return c.Status(500).SendString("Failed to render page")
+	}
+	c.Type("html", "utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// uiAll lists records of all feeds of the sidebar, newest first.
+func (s *Server) uiAll(c *fiber.Ctx) error {
+	return s.uiRecords(c, nil)
+}
+
+func (s *Server) uiFeed(c *fiber.Ctx) error {
+	feed, err := s.db.GetFeedBySlug(c.Params("slug"))
+	if err != nil {
+		return c.Status(404).SendString("Feed not found")
+	}
+	return s.uiRecords(c, &feed)
+}
+
+// uiRecords lists records of the feed, or of all feeds if it is nil. The
+// unread query parameter lists unread records only.
+func (s *Server) uiRecords(c *fiber.Ctx, feed *internal.Feed) error {
+	title, active := "All", ""
+	filter := internal.RecordFilter{
+		Unread: c.QueryBool("unread"),
+		Limit:  c.QueryInt("limit", 100),
+	}
+	if user, ok := currentUser(c); ok {
+		filter.UserID = user.ID
+	}
+	if feed != nil {
+		title, active = feed.Slug, feed.Slug
+		filter.FeedIDs = []string{feed.ID}
+	}
+
+	page, err := s.newPage(c, title, active)
+	if err != nil {
+		log.Printf("Failed to get feeds: %v", err)
+		return c.Status(500).SendString("Failed to get feeds")
+	}
+	page.Feed = feed
+	page.Unread = filter.Unread
+	page.Records, err = s.db.GetRecords(filter)
+	if err != nil {
+		log.Printf("Failed to get records: %v", err)
+		return c.Status(500).SendString("Failed to get records")
+	}
+	return sendPage(c, listTemplate, page)
+}
+
+// uiRecord shows the record with the extracted page content, or the
+// content of the feed if the page is not extracted. The script of the
+// page marks it read once shown.
+func (s *Server) uiRecord(c *fiber.Ctx) error {
+	rec, err := s.db.GetRecord(c.Params("id"))
+	if err != nil {
+		return c.Status(404).SendString("Record not found")
+	}
+
+	page, err := s.newPage(c, rec.Title, rec.FeedSlug)
+	if err != nil {
+		log.Printf("Failed to get feeds: %v", err)
+		return c.Status(500).SendString("Failed to get feeds")
+	}
+	page.Record = &rec
+	page.Content = recordHtml(rec)
+	return sendPage(c, articleTemplate, page)
+}
+
+// recordHtml renders the content of the record: markdown extracted from
+// its page, or the HTML given by the feed, sanitized. The description
+// stands in for content the feed does not give.
+func recordHtml(rec internal.Record) template.HTML {
+	if rec.Extracted {
+		return markdownHtml(rec.Content)
+	}
+	content := rec.Content
+	if content == "" {
+		content = rec.Description
+	}
+	return template.HTML(feedHtmlPolicy.Sanitize(content))
+}
+
+// markdownHtml renders extracted content, which is markdown. Raw HTML of
+// the content is left out.
+func markdownHtml(content string) template.HTML {
+	var buf bytes.Buffer
+	err := goldmark.Convert([]byte(content), &buf)
+	if err != nil {
+		return template.HTML("<pre>" + template.HTMLEscapeString(content) + "</pre>")
+	}
+	return template.HTML(buf.String())
+}
+
+// setRead changes the read state of the record for the signed in user,
+// or for everyone if authentication is off. Read-only users change
+// nothing.
+func (s *Server) setRead(c *fiber.Ctx, id string, read bool) error {
+	if !s.canWrite(c) {
+		return nil
+	}
+	if user, ok := currentUser(c); ok {
+		return s.db.SetUserRecordState(user.ID, id, internal.RecordStateRead, read)
+	}
+	return s.db.SetRecordRead(id, read)
+}
+
+// uiMarkRead is posted by the script of the article page once it is
+// shown.
+func (s *Server) uiMarkRead(c *fiber.Ctx) error {
+	if !s.canWrite(c) {
+		return unauthorized(c)
+	}
+	rec, err := s.db.GetRecord(c.Params("id"))
+	if err != nil {
+		return c.Status(404).SendString("Record not found")
+	}
+	err = s.setRead(c, rec.ID, true)
+	if err != nil {
+		log.Printf("Failed to mark record %s read: %v", rec.ID, err)
+		return c.Status(500).SendString("Failed to update record")
+	}
+	return c.SendStatus(204)
+}
+
+func (s *Server) uiMarkUnread(c *fiber.Ctx) error {
+	if !s.canWrite(c) {
+		return unauthorized(c)
+	}
+	rec, err := s.db.GetRecord(c.Params("id"))
+	if err != nil {
+		return c.Status(404).SendString("Record not found")
+	}
+	err = s.setRead(c, rec.ID, false)
+	if err != nil {
+		log.Printf("Failed to mark record %s unread: %v", rec.ID, err)
+		return c.Status(500).SendString("Failed to update record")
+	}
+	return c.Redirect("/ui/feed/"+url.PathEscape(rec.FeedSlug), 303)
+}
+
+// uiAddFeed adds the feed of the form. Signed in users are subscribed to
+// it, admins and anyone if authentication is off may add feeds not known
+// yet.
+func (s *Server) uiAddFeed(c *fiber.Ctx) error {
+	if !s.canWrite(c) {
+		return unauthorized(c)
+	}
+	user, signedIn := currentUser(c)
+
+	feed, err := s.db.FindFeedByUrl(c.FormValue("url"))
+	if err != nil {
+		if signedIn && !user.Admin {
+			return uiError(c, "/", "Only admins add new feeds")
+		}
+		feed = internal.Feed{
+			Slug:      c.FormValue("slug"),
+			Url:       c.FormValue("url"),
+			RefreshMs: minRefreshMs,
+		}
+		if feed.Slug == "" {
+			feed.Slug = urlSlug(feed.Url)
+		}
+		err = validateFeed(feed)
+		if err == nil {
+			err = s.checkFeedConflict(feed)
+		}
+		if err != nil {
+			return uiError(c, "/", err.Error())
+		}
+		feed, err = s.addFeed(feed)
+		if err != nil {
+			log.Printf("Failed to add feed %s: %v", feed.Url, err)
+			return uiError(c, "/", "Failed to add feed")
+		}
+	}
+
+	if signedIn {
+		err = s.db.AddSubscription(user.ID, feed.ID)
+		if err != nil {
+			log.Printf("Failed to subscribe %s to %s: %v", user.Name, feed.Slug, err)
+			return uiError(c, "/", "Failed to subscribe to feed")
+		}
+	}
+	return c.Redirect("/ui/feed/"+url.PathEscape(feed.Slug), 303)
+}
+
+// uiDeleteFeed unsubscribes the signed in user from the feed. The feed is
+// deleted if authentication is off.
+func (s *Server) uiDeleteFeed(c *fiber.Ctx) error {
+	if !s.canWrite(c) {
+		return unauthorized(c)
+	}
+	feed, err := s.db.GetFeedBySlug(c.Params("slug"))
+	if err != nil {
+		return c.Status(404).SendString("Feed not found")
+	}
+
+	if user, ok := currentUser(c); ok {
+		err = s.db.DeleteSubscription(user.ID, feed.ID)
+	} else {
+		err = s.removeFeed(feed)
+	}
+	if err != nil {
+		log.Printf("Failed to remove feed %s: %v", feed.Slug, err)
+		return uiError(c, "/ui/feed/"+url.PathEscape(feed.Slug), "Failed to remove feed")
+	}
+	return c.Redirect("/", 303)
+}
+
+// uiError shows the message on the page of the path.
+func uiError(c *fiber.Ctx, path string, message string) error {
+	return c.Redirect(fmt.Sprintf("%s?error=%s", path, url.QueryEscape(message)), 303)
+}
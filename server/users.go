@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+)
+
+// privateRoutes serves feeds of a user at URLs with a secret feed token,
+// e.g. /u/<token>/unread. Records are limited to subscriptions of the user
+// and have the read state of the user.
+func (s *Server) privateRoutes() {
+	u := s.app.Group("/u/:token", s.feedTokenUser)
+	u.Get("/all", s.getUserAll)
+	u.Get("/unread", s.getUserUnread)
+	u.Get("/starred", s.getUserStarred)
+	u.Get("/feed/:slug", s.getUserFeed)
+}
+
+// feedTokenUser finds the user by the feed token of the URL.
+func (s *Server) feedTokenUser(c *fiber.Ctx) error {
+	user, err := s.db.FindUserByToken(auth.HashToken(c.Params("token")), internal.TokenKindFeed)
+	if err != nil {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+	c.Locals("user", user)
+	return c.Next()
+}
+
+func (s *Server) privateBase(c *fiber.Ctx) string {
+	return fmt.Sprintf("%s/u/%s", s.baseUrl, c.Params("token"))
+}
+
+func (s *Server) getUserAll(c *fiber.Ctx) error {
+	user := c.Locals("user").(internal.User)
+	return s.sendRecords(c, s.privateBase(c), "All feeds", "all", internal.RecordFilter{
+		UserID: user.ID,
+		Limit:  c.QueryInt("limit", 100),
+	})
+}
+
+func (s *Server) getUserUnread(c *fiber.Ctx) error {
+	user := c.Locals("user").(internal.User)
+	return s.sendRecords(c, s.privateBase(c), "Unread", "unread", internal.RecordFilter{
+		UserID: user.ID,
+		Unread: true,
+		Limit:  c.QueryInt("limit", 100),
+	})
+}
+
+func (s *Server) getUserStarred(c *fiber.Ctx) error {
+	user := c.Locals("user").(internal.User)
+	return s.sendRecords(c, s.privateBase(c), "Starred", "starred", internal.RecordFilter{
+		UserID:  user.ID,
+		Starred: true,
+		Limit:   c.QueryInt("limit", 100),
+	})
+}
+
+// getUserFeed serves a feed the user is subscribed to.
+func (s *Server) getUserFeed(c *fiber.Ctx) error {
+	user := c.Locals("user").(internal.User)
+	feeds, err := s.db.GetSubscriptions(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(&fiber.Map{
+			"error": "Failed to get subscriptions",
+		})
+	}
+	var feed internal.Feed
+	for _, f := range feeds {
+		if f.Slug == c.Params("slug") {
+			feed = f
+		}
+	}
+	if feed.ID == "" {
+		return c.Status(404).JSON(&fiber.Map{
+			"error": "Feed not found",
+		})
+	}
+
+	return s.sendRecords(c, s.privateBase(c), feed.Slug, "feed/"+feed.Slug, internal.RecordFilter{
+		UserID:  user.ID,
+		FeedIDs: []string{feed.ID},
+		Limit:   c.QueryInt("limit", 100),
+	})
+}
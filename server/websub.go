@@ -0,0 +1,107 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/websub"
+)
+
+// websubDefaultLease is used if a hub verifies a subscription without
+// telling its lease.
+const websubDefaultLease = 24 * 60 * 60
+
+// websubRoutes serves callbacks of WebSub hubs. Hubs verify subscriptions
+// with GET requests and push content of feeds with POST requests.
+func (s *Server) websubRoutes() {
+	s.app.Get("/websub/callback/:feed", s.websubVerify)
+	s.app.Post("/websub/callback/:feed", s.websubPush)
+}
+
+// websubVerify confirms requests the hub is asked for by echoing the
+// challenge. Only a pending request of the same topic and mode is
+// confirmed, others are answered with 404.
+func (s *Server) websubVerify(c *fiber.Ctx) error {
+	sub, err := s.db.GetWebSubSubscription(c.Params("feed"))
+	if err != nil || c.Query("hub.topic") != sub.Topic {
+		return c.Status(404).SendString("Unknown subscription")
+	}
+
+	mode := c.Query("hub.mode")
+	switch mode {
+	case "subscribe", "unsubscribe":
+		if sub.Requested != mode {
+			return c.Status(404).SendString("No pending request")
+		}
+	}
+
+	switch mode {
+	case "subscribe":
+		lease := c.QueryInt("hub.lease_seconds", websubDefaultLease)
+		if lease <= 0 {
+			lease = websubDefaultLease
+		}
+		sub.State = internal.WebSubActive
+		sub.Requested = ""
+		sub.Lease = int64(lease)
+		sub.ExpiresAt = time.Now().Add(time.Duration(lease) * time.Second)
+		sub.Error = ""
+		err = s.db.SaveWebSubSubscription(sub)
+		if err != nil {
+			log.Printf("Failed to save WebSub subscription of %s: %v", sub.FeedID, err)
+			return c.Status(500).SendString("Failed to save subscription")
+		}
+		log.Printf("Hub %s verified subscription of %s for %d s", sub.Hub, sub.Topic, lease)
+		return c.SendString(c.Query("hub.challenge"))
+	case "unsubscribe":
+		err = s.db.DeleteWebSubSubscription(sub.FeedID)
+		if err != nil {
+			log.Printf("Failed to delete WebSub subscription of %s: %v", sub.FeedID, err)
+			return c.Status(500).SendString("Failed to delete subscription")
+		}
+		log.Printf("Hub %s verified unsubscription of %s", sub.Hub, sub.Topic)
+		return c.SendString(c.Query("hub.challenge"))
+	case "denied":
+		sub.State = internal.WebSubFailed
+		sub.Requested = ""
+		sub.Error = "denied: " + c.Query("hub.reason")
+		err = s.db.SaveWebSubSubscription(sub)
+		if err != nil {
+			log.Printf("Failed to save WebSub subscription of %s: %v", sub.FeedID, err)
+		}
+		log.Printf("Hub %s denied subscription of %s: %s", sub.Hub, sub.Topic, c.Query("hub.reason"))
+		return c.SendStatus(200)
+	}
+	return c.Status(404).SendString("Unknown mode")
+}
+
+// websubPush adds records of the pushed content. Content with a wrong
+// signature is acknowledged but ignored, as the spec asks. Pushes to
+// feeds not subscribed anymore are answered with 410, so hubs stop them.
+func (s *Server) websubPush(c *fiber.Ctx) error {
+	sub, err := s.db.GetWebSubSubscription(c.Params("feed"))
+	if err != nil {
+		return c.SendStatus(410)
+	}
+	body := c.Body()
+	if !websub.VerifySignature(sub.Secret, c.Get(websub.SignatureHeader), body) {
+		log.Printf("Ignored content pushed to %s with a wrong signature", sub.Topic)
+		return c.SendStatus(202)
+	}
+
+	feed, err := s.db.GetFeedByID(sub.FeedID)
+	if err != nil {
+		return c.SendStatus(410)
+	}
+	if s.runner == nil {
+		return c.SendStatus(503)
+	}
+	err = s.runner.Push(feed, body)
+	if err != nil {
+		log.Printf("Failed to add content pushed to %s: %v", feed.Slug, err)
+		return c.Status(400).SendString("Failed to parse feed")
+	}
+	return c.SendStatus(202)
+}
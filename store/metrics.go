@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tmshv/feeder/metrics"
+)
+
+// instrumentedDB times statements by the store method running them.
+// Transactions are timed from Begin to Commit or Rollback.
+type instrumentedDB struct {
+	*sql.DB
+}
+
+func (db instrumentedDB) Exec(query string, args ...any) (sql.Result, error) {
+	defer observe(caller(), time.Now())
+	return db.DB.Exec(query, args...)
+}
+
+// Query is timed until the rows are closed, as they are read from the
+// database while they are iterated.
+func (db instrumentedDB) Query(query string, args ...any) (*instrumentedRows, error) {
+	method, start := caller(), time.Now()
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		observe(method, start)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, method: method, start: start}, nil
+}
+
+func (db instrumentedDB) QueryRow(query string, args ...any) *sql.Row {
+	defer observe(caller(), time.Now())
+	return db.DB.QueryRow(query, args...)
+}
+
+func (db instrumentedDB) Prepare(query string) (instrumentedStmt, error) {
+	stmt, err := db.DB.Prepare(query)
+	return instrumentedStmt{Stmt: stmt, method: caller()}, err
+}
+
+func (db instrumentedDB) Begin() (instrumentedTx, error) {
+	tx, err := db.DB.Begin()
+	return instrumentedTx{Tx: tx, method: caller(), start: time.Now()}, err
+}
+
+type instrumentedStmt struct {
+	*sql.Stmt
+	method string
+}
+
+func (stmt instrumentedStmt) Exec(args ...any) (sql.Result, error) {
+	defer observe(stmt.method, time.Now())
+	return stmt.Stmt.Exec(args...)
+}
+
+type instrumentedRows struct {
+	*sql.Rows
+	method string
+	start  time.Time
+	closed bool
+}
+
+func (rows *instrumentedRows) Close() error {
+	if !rows.closed {
+		rows.closed = true
+		observe(rows.method, rows.start)
+	}
+	return rows.Rows.Close()
+}
+
+type instrumentedTx struct {
+	*sql.Tx
+	method string
+	start  time.Time
+}
+
+func (tx instrumentedTx) Commit() error {
+	defer observe(tx.method, tx.start)
+	return tx.Tx.Commit()
+}
+
+func (tx instrumentedTx) Rollback() error {
+	defer observe(tx.method, tx.start)
+	return tx.Tx.Rollback()
+}
+
+func observe(method string, start time.Time) {
+	metrics.QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// caller names the store method calling the instrumented one, like
+// GetRecords.
+func caller() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimPrefix(name, "store.")
+	return strings.TrimPrefix(name, "(*SqliteStore).")
+}
@@ -0,0 +1,127 @@
+//go:build sqlite_fts5
+
+package store
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmshv/feeder/blob"
+	"github.com/tmshv/feeder/internal"
+)
+
+func newTestStore(t *testing.T) *SqliteStore {
+	dir := t.TempDir()
+	blobs, err := blob.NewFileStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := openSqliteStore(filepath.Join(dir, "feed.db"), "../migrations", blobs, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+func addTestFeed(t *testing.T, s *SqliteStore, slug string) internal.Feed {
+	err := s.AddFeed(slug, "https://example.com/"+slug+".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := s.GetFeedBySlug(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func addTestRecord(t *testing.T, s *SqliteStore, rec internal.Record) {
+	rec.LinkKey = rec.Link
+	_, err := s.AddRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func searchIDs(results []internal.SearchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, res := range results {
+		ids = append(ids, res.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestStore(t)
+	news := addTestFeed(t, s, "news")
+	blog := addTestFeed(t, s, "blog")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	addTestRecord(t, s, internal.Record{ID: "a", FeedID: news.ID, Title: "Rust release", Description: "A compiler update", Link: "https://example.com/a", PublishedAt: now.Add(-2 * time.Hour)})
+	addTestRecord(t, s, internal.Record{ID: "b", FeedID: blog.ID, Title: "Weekend notes", Description: "About the rust on my bike", Link: "https://example.com/b", PublishedAt: now.Add(-time.Hour)})
+	addTestRecord(t, s, internal.Record{ID: "c", FeedID: news.ID, Title: "Elections", Description: "Results are in", Link: "https://example.com/c", PublishedAt: now})
+
+	err := s.AddPage(internal.Page{Url: "https://example.com/c", Content: "The turnout of the elections was the highest in decades", Status: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter internal.SearchFilter
+		want   []string
+	}{
+		{name: "title and description", query: "rust", filter: internal.SearchFilter{Newest: true}, want: []string{"b", "a"}},
+		{name: "feed", query: "rust", filter: internal.SearchFilter{FeedIDs: []string{news.ID}}, want: []string{"a"}},
+		{name: "since", query: "rust", filter: internal.SearchFilter{Since: now.Add(-90 * time.Minute)}, want: []string{"b"}},
+		{name: "until", query: "rust", filter: internal.SearchFilter{Until: now.Add(-90 * time.Minute)}, want: []string{"a"}},
+		{name: "limit", query: "rust", filter: internal.SearchFilter{Newest: true, Limit: 1}, want: []string{"b"}},
+		{name: "page content", query: "turnout", want: []string{"c"}},
+		{name: "diacritics", query: "décades", want: []string{"c"}},
+		{name: "no match", query: "python", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := s.Search(tt.query, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := searchIDs(results)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	s := newTestStore(t)
+	feed := addTestFeed(t, s, "news")
+	addTestRecord(t, s, internal.Record{ID: "a", FeedID: feed.ID, Title: "<b>Rust</b> release", Link: "https://example.com/a", PublishedAt: time.Now()})
+
+	results, err := s.Search("rust", internal.SearchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Search() returned %d results, want 1", len(results))
+	}
+	want := "&lt;b&gt;<mark>Rust</mark>&lt;/b&gt; release"
+	if results[0].Snippet != want {
+		t.Errorf("Snippet = %q, want %q", results[0].Snippet, want)
+	}
+}
+
+func TestSearchBadQuery(t *testing.T) {
+	s := newTestStore(t)
+	_, err := s.Search(`"unterminated`, internal.SearchFilter{})
+	if err == nil {
+		t.Error("Search() of a bad query returned no error")
+	}
+}
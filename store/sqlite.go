@@ -2,9 +2,12 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"log"
-	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -12,20 +15,49 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tmshv/feeder/blob"
 	"github.com/tmshv/feeder/internal"
 )
 
 type SqliteStore struct {
 	logger *log.Logger
-	db     *sql.DB
+	db     instrumentedDB
+	blobs  blob.Store
 }
 
 func (s *SqliteStore) Close() error {
-    return s.db.Close()
+	return s.db.Close()
+}
+
+// ErrNoFts5 tells SQLite is built without the FTS5 extension the search
+// index is made with.
+var ErrNoFts5 = errors.New("SQLite is built without FTS5, build feeder with -tags sqlite_fts5")
+
+// ErrSlugTaken is returned when a feed or a saved search is added with the
+// slug of the other kind. Both are served at /feed/<slug>.
+var ErrSlugTaken = errors.New("slug is taken")
+
+// checkFts5 fails with ErrNoFts5 before migrations fail to make the search
+// index.
+func (s *SqliteStore) checkFts5() error {
+	var enabled bool
+	err := s.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNoFts5
+	}
+	return nil
 }
 
 func (s *SqliteStore) setup(migrationsPath string) error {
-	driver, err := sqlite3.WithInstance(s.db, &sqlite3.Config{
+	err := s.checkFts5()
+	if err != nil {
+		return err
+	}
+
+	driver, err := sqlite3.WithInstance(s.db.DB, &sqlite3.Config{
 		MigrationsTable: "migrations",
 	})
 	if err != nil {
@@ -53,9 +85,9 @@ func (s *SqliteStore) setup(migrationsPath string) error {
 func (s *SqliteStore) AddFeed(slug string, url string) error {
 	stmt, err := s.db.Prepare(`
         INSERT INTO
-        feeds(id, slug, url, created_at, updated_at)
-        VALUES
-        (?, ?, ?, ?, ?)
+        feeds(id, num, slug, url, created_at, updated_at)
+        SELECT ?, (SELECT COALESCE(MAX(num), 0) + 1 FROM feeds), ?, ?, ?, ?
+        WHERE NOT EXISTS (SELECT 1 FROM saved_searches WHERE slug = ?)
     `)
 	if err != nil {
 		return err
@@ -63,42 +95,71 @@ func (s *SqliteStore) AddFeed(slug string, url string) error {
 
 	id := uuid.NewString()
 	now := time.Now()
-	_, err = stmt.Exec(id, slug, url, now, now)
+	res, err := stmt.Exec(id, slug, url, now, now, slug)
+	if err != nil {
+		return err
+	}
+	added, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if added == 0 {
+		return ErrSlugTaken
+	}
 	return nil
 }
 
-func (s *SqliteStore) AddPage(url string, html string, content string) error {
+// AddPage stores the page fetched from its url. Records are joined with
+// pages by the canonical url, the url unless the page has another one.
+func (s *SqliteStore) AddPage(page internal.Page) error {
 	stmt, err := s.db.Prepare(`
         INSERT INTO
-        pages(url, created_at, html, content)
+        pages(url, canonical_url, created_at, html, html_hash, content, title, published_at, status, request_headers, response_headers, page_index)
         VALUES
-        (?, ?, ?, ?)
+        (?, ?, ?, '', ?, ?, ?, ?, ?, ?, ?, ?)
     `)
 	if err != nil {
 		return err
 	}
 
+	hash, err := s.blobs.Put([]byte(page.Html))
+	if err != nil {
+		return err
+	}
+
+	var publishedAt *time.Time
+	if !page.PublishedAt.IsZero() {
+		publishedAt = &page.PublishedAt
+	}
+
 	now := time.Now()
-	_, err = stmt.Exec(url, now, html, content)
+	_, err = stmt.Exec(page.Url, pageKey(page), now, hash, page.Content, page.Title, publishedAt, page.Status, page.RequestHeaders, page.ResponseHeaders, page.Index)
 	if err != nil {
 		return err
 	}
-	return nil
+	return s.indexPageContent(pageKey(page), page.Content)
+}
+
+// pageKey is the url records of the page link to.
+func pageKey(page internal.Page) string {
+	if page.CanonicalUrl != "" {
+		return page.CanonicalUrl
+	}
+	return page.Url
 }
 
-func (s *SqliteStore) UpdatePageContent(page *internal.Page, content string) error {
+// UpdatePageArticle saves the title and the content of the article
+// extracted again from the page.
+func (s *SqliteStore) UpdatePageArticle(page *internal.Page, title string, content string) error {
 	stmt, err := s.db.Prepare(`
         UPDATE pages
-        SET content = ?
+        SET title = ?, content = ?
         WHERE url = ? AND created_at = ?
     `)
 	if err != nil {
 		return err
 	}
-	res, err := stmt.Exec(content, page.Url, page.CreatedAt)
+	res, err := stmt.Exec(title, content, page.Url, page.CreatedAt)
 	if err != nil {
 		return err
 	}
@@ -109,63 +170,110 @@ func (s *SqliteStore) UpdatePageContent(page *internal.Page, content string) err
 	}
 	if x == 0 {
 		log.Printf("Content of Page %s is not updated", page.Url)
+		return nil
 	}
 
-	return nil
+	return s.indexPageContent(pageKey(*page), content)
 }
 
-func (s *SqliteStore) GetFeedBySlug(slug string) (internal.Feed, error) {
+// indexPageContent puts extracted content of the page to the search index
+// of records linking to its canonical url, in place of the content given
+// by the feed.
+func (s *SqliteStore) indexPageContent(url string, content string) error {
+	if content == "" {
+		return nil
+	}
+	_, err := s.db.Exec(`
+        UPDATE records_search
+        SET content = ?
+        WHERE record_id IN (SELECT id FROM records WHERE COALESCE(canonical_link, link) = ?)
+    `, content, url)
+	return err
+}
+
+const feedColumns = "id, COALESCE(num, 0), slug, url, created_at, updated_at, refresh_ms, COALESCE(extract_rules, '')"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFeed(row scanner) (internal.Feed, error) {
 	var feed internal.Feed
-	row := s.db.QueryRow(`
-        SELECT id, slug, url, created_at, updated_at, refresh_ms
-        FROM feeds
-        WHERE slug = ?
-        LIMIT 1
-        ;
-    `, slug)
+	var rules string
 	err := row.Scan(
 		&feed.ID,
+		&feed.Num,
 		&feed.Slug,
 		&feed.Url,
 		&feed.CreatedAt,
 		&feed.UpdatedAt,
 		&feed.RefreshMs,
+		&rules,
 	)
 	if err != nil {
 		return internal.Feed{}, err
 	}
+	if rules != "" {
+		err = json.Unmarshal([]byte(rules), &feed.Extract)
+		if err != nil {
+			return internal.Feed{}, err
+		}
+	}
 	return feed, nil
 }
 
+func (s *SqliteStore) GetFeedBySlug(slug string) (internal.Feed, error) {
+	row := s.db.QueryRow(`
+        SELECT `+feedColumns+`
+        FROM feeds
+        WHERE slug = ?
+        LIMIT 1
+        ;
+    `, slug)
+	return scanFeed(row)
+}
+
+func (s *SqliteStore) GetFeedByID(id string) (internal.Feed, error) {
+	row := s.db.QueryRow(`
+        SELECT `+feedColumns+`
+        FROM feeds
+        WHERE id = ?
+        LIMIT 1
+        ;
+    `, id)
+	return scanFeed(row)
+}
+
 func (s *SqliteStore) FindFeedByUrl(feedUrl string) (internal.Feed, error) {
-	var feed internal.Feed
 	row := s.db.QueryRow(`
-        SELECT id, slug, url, created_at, updated_at, refresh_ms
+        SELECT `+feedColumns+`
         FROM feeds
         WHERE url = ?
         LIMIT 1
         ;
     `, feedUrl)
-	err := row.Scan(
-		&feed.ID,
-		&feed.Slug,
-		&feed.Url,
-		&feed.CreatedAt,
-		&feed.UpdatedAt,
-		&feed.RefreshMs,
-	)
-	if err != nil {
-		return internal.Feed{}, err
-	}
-	return feed, nil
+	return scanFeed(row)
+}
+
+// FindRecordByPageUrl finds the newest record linking to the page.
+func (s *SqliteStore) FindRecordByPageUrl(pageUrl string) (internal.Record, error) {
+	row := s.db.QueryRow(`
+        SELECT `+recordColumns("r")+`
+        FROM records r
+        JOIN feeds f ON f.id = r.feed_id
+        WHERE COALESCE(r.canonical_link, r.link) = ?
+        ORDER BY r.published_at DESC
+        LIMIT 1
+        ;
+    `, pageUrl)
+	return scanRecord(row)
 }
 
 func (s *SqliteStore) GetFeeds() ([]internal.Feed, error) {
 	result := make([]internal.Feed, 0)
 
 	rows, err := s.db.Query(`
-        SELECT
-        id, slug, url, created_at, updated_at, refresh_ms
+        SELECT ` + feedColumns + `
         FROM feeds
         ;
     `)
@@ -175,124 +283,316 @@ func (s *SqliteStore) GetFeeds() ([]internal.Feed, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		feed := internal.Feed{}
-		err := rows.Scan(
-			&feed.ID,
-			&feed.Slug,
-			&feed.Url,
-			&feed.CreatedAt,
-			&feed.UpdatedAt,
-			&feed.RefreshMs,
-		)
+		feed, err := scanFeed(rows)
 		if err != nil {
 			log.Println("Failed to get row")
 			continue
 		}
 
-		// TODO do someting with it
-		feed.RefreshMs += int64(rand.Intn(10000))
-
 		result = append(result, feed)
 	}
 
 	return result, nil
 }
 
+func (s *SqliteStore) UpdateFeedExtractRules(feedID string, rules internal.ExtractRules) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := s.db.Prepare(`
+        UPDATE feeds
+        SET extract_rules = ?, updated_at = ?
+        WHERE id = ?
+    `)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(string(data), time.Now(), feedID)
+	return err
+}
+
+// UpdateFeed saves slug, url, refresh period and extraction rules of the
+// feed. Hub subscribers of the feed are unsubscribed if the slug changes,
+// as they are subscribed to the URL of the old one.
+func (s *SqliteStore) UpdateFeed(feed internal.Feed) error {
+	data, err := json.Marshal(feed.Extract)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        DELETE FROM hub_subscriptions
+        WHERE feed IN (SELECT slug FROM feeds WHERE id = ? AND slug <> ?)
+    `, feed.ID, feed.Slug)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	res, err := tx.Exec(`
+        UPDATE feeds
+        SET slug = ?, url = ?, refresh_ms = ?, extract_rules = ?, updated_at = ?
+        WHERE id = ?
+    `, feed.Slug, feed.Url, feed.RefreshMs, string(data), time.Now(), feed.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// DeleteFeed deletes the feed with its records and subscribers. Fetched
+// pages are kept.
+func (s *SqliteStore) DeleteFeed(feedID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	queries := []string{
+		`DELETE FROM record_tags WHERE record_id IN (SELECT id FROM records WHERE feed_id = ?)`,
+		`DELETE FROM user_record_state WHERE record_id IN (SELECT id FROM records WHERE feed_id = ?)`,
+		`DELETE FROM records_search WHERE feed_id = ?`,
+		`DELETE FROM records WHERE feed_id = ?`,
+		`DELETE FROM subscriptions WHERE feed_id = ?`,
+		`DELETE FROM feed_groups WHERE feed_id = ?`,
+		`DELETE FROM rules WHERE feed_id = ?`,
+		`DELETE FROM websub_subscriptions WHERE feed_id = ?`,
+		`DELETE FROM hub_subscriptions WHERE feed = (SELECT slug FROM feeds WHERE id = ?)`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query, feedID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM feeds WHERE id = ?`, feedID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// AddRecord adds the record unless a record with the same link or link
+// key was published at the same time. It returns the number of added
+// records.
 func (s *SqliteStore) AddRecord(item internal.Record) (int64, error) {
 	stmt, err := s.db.Prepare(`
         INSERT OR IGNORE INTO
-        records(id, feed_id, title, description, content, published_at, link)
-        VALUES
-        (?, ?, ?, ?, ?, ?, ?)
+        records(id, num, feed_id, title, description, content, published_at, link, canonical_link, link_key, read_at, skip_page, created_at)
+        SELECT ?, (SELECT COALESCE(MAX(num), 0) + 1 FROM records), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+        WHERE NOT EXISTS (SELECT 1 FROM records WHERE link_key = ? AND published_at = ?)
     `)
 	if err != nil {
 		return 0, err
 	}
 
-	res, err := stmt.Exec(item.ID, item.FeedID, item.Title, item.Description, item.Content, item.PublishedAt, item.Link)
+	res, err := stmt.Exec(item.ID, item.FeedID, item.Title, item.Description, item.Content, item.PublishedAt, item.Link, nullString(item.CanonicalLink), nullString(item.LinkKey), nullTime(item.ReadAt), item.SkipPage, time.Now(), item.LinkKey, item.PublishedAt)
 	if err != nil {
 		return 0, err
 	}
-	return res.RowsAffected()
-}
+	added, err := res.RowsAffected()
+	if err != nil || added == 0 {
+		return added, err
+	}
 
-func (s *SqliteStore) FindRecordsWithNoPage() ([]string, error) {
-	result := make([]string, 0)
-	rows, err := s.db.Query(`
-        SELECT records.link
-        FROM records
-        LEFT JOIN pages ON records.link = pages.url
-        WHERE pages.url IS NULL;
-    `)
+	_, err = s.db.Exec(`
+        INSERT INTO
+        records_search(record_id, feed_id, title, description, content)
+        VALUES
+        (?, ?, ?, ?, ?)
+    `, item.ID, item.FeedID, item.Title, item.Description, item.Content)
 	if err != nil {
-		return nil, err
+		return added, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var url string
-		err := rows.Scan(&url)
+	err = s.AddRecordTags(item.ID, item.Tags)
+	if err != nil {
+		return added, err
+	}
+	return added, nil
+}
+
+// HasRecordLink tells if the feed has a record with the link.
+func (s *SqliteStore) HasRecordLink(feedID string, link string) (bool, error) {
+	var found bool
+	err := s.db.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM records WHERE feed_id = ? AND link = ?)
+    `, feedID, link).Scan(&found)
+	return found, err
+}
+
+func (s *SqliteStore) AddRecordTags(recordID string, tags []string) error {
+	for _, tag := range tags {
+		_, err := s.db.Exec(`
+            INSERT OR IGNORE INTO
+            record_tags(record_id, tag)
+            VALUES
+            (?, ?)
+        `, recordID, tag)
 		if err != nil {
-			log.Printf("Failed to get row: %v", err)
-			continue
+			return err
 		}
-		result = append(result, url)
 	}
+	return nil
+}
 
-	return result, nil
+func (s *SqliteStore) UpdateRecordCanonicalLink(recordID string, link string) error {
+	_, err := s.db.Exec(`
+        UPDATE records
+        SET canonical_link = ?
+        WHERE id = ?
+    `, nullString(link), recordID)
+	return err
+}
+
+func (s *SqliteStore) SetRecordStory(recordID string, simhash uint64, storyID string) error {
+	_, err := s.db.Exec(`
+        UPDATE records
+        SET simhash = ?, story_id = ?
+        WHERE id = ?
+    `, int64(simhash), nullString(storyID), recordID)
+	return err
 }
 
-func (s *SqliteStore) GetAllPages() ([]internal.Page, error) {
-	result := make([]internal.Page, 0)
+// GetStoryCandidates lists records published in the period other records
+// may be compared with to find the same story.
+func (s *SqliteStore) GetStoryCandidates(recordID string, since time.Time, until time.Time) ([]internal.Record, error) {
 	rows, err := s.db.Query(`
         SELECT
-            url,
-            html,
-            content,
-            created_at
-        FROM pages
+            id,
+            feed_id,
+            link,
+            COALESCE(canonical_link, ''),
+            COALESCE(simhash, 0),
+            COALESCE(story_id, id)
+        FROM records
+        WHERE id != ? AND published_at >= ? AND published_at < ?
         ;
-    `)
+    `, recordID, since, until)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	result := make([]internal.Record, 0)
 	for rows.Next() {
-		var page internal.Page
-		err := rows.Scan(
-			&page.Url,
-			&page.Html,
-			&page.Content,
-			&page.CreatedAt,
-		)
+		var rec internal.Record
+		var simhash int64
+		err := rows.Scan(&rec.ID, &rec.FeedID, &rec.Link, &rec.CanonicalLink, &simhash, &rec.StoryID)
 		if err != nil {
 			log.Printf("Failed to get row: %v", err)
 			continue
 		}
-		result = append(result, page)
+		rec.Simhash = uint64(simhash)
+		result = append(result, rec)
+	}
+	return result, rows.Err()
+}
+
+// setRecordTime sets the state column of the record to now, keeping the
+// time it was set first, or clears it.
+func (s *SqliteStore) setRecordTime(recordID string, column string, on bool) error {
+	var value sql.NullTime
+	if on {
+		value = nullTime(time.Now())
+	}
+	res, err := s.db.Exec(fmt.Sprintf(`
+        UPDATE records
+        SET %[1]s = CASE WHEN ? THEN COALESCE(%[1]s, ?) ELSE NULL END
+        WHERE id = ?
+    `, column), on, value, recordID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
 
-	return result, nil
+func (s *SqliteStore) SetRecordRead(recordID string, read bool) error {
+	return s.setRecordTime(recordID, "read_at", read)
 }
 
-func (s *SqliteStore) GetFeedRecords(feedId string, mdContent bool) ([]internal.Record, error) {
-	log.Print("[WARN] mdContent is not implemented")
+func (s *SqliteStore) SetRecordStarred(recordID string, starred bool) error {
+	return s.setRecordTime(recordID, "starred_at", starred)
+}
+
+func (s *SqliteStore) SetRecordArchived(recordID string, archived bool) error {
+	return s.setRecordTime(recordID, "archived_at", archived)
+}
+
+// MarkFeedRead marks records of the feed published before the time as read.
+// It returns the number of records marked.
+func (s *SqliteStore) MarkFeedRead(feedID string, before time.Time) (int64, error) {
+	res, err := s.db.Exec(`
+        UPDATE records
+        SET read_at = ?
+        WHERE feed_id = ? AND published_at < ? AND read_at IS NULL
+    `, time.Now(), feedID, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// recordTagsColumn selects tags of the record aliased as r joined with
+// tagSeparator.
+const recordTagsColumn = `COALESCE((SELECT group_concat(tag, char(31)) FROM record_tags WHERE record_id = r.id), '')`
+
+const tagSeparator = "\x1f"
+
+func splitTags(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, tagSeparator)
+}
+
+func (s *SqliteStore) FindRecordsWithNoPage() ([]internal.Record, error) {
 	result := make([]internal.Record, 0)
 	rows, err := s.db.Query(`
         SELECT
-            r.id,
-            r.title,
-            r.description,
-            p.content,
-            r.published_at,
-            r.link
-        FROM records r
-        JOIN pages p
-        ON p.url = r.link
-        WHERE r.feed_id = ?
-        ;
-    `, feedId)
+            records.id,
+            records.feed_id,
+            COALESCE(records.title, ''),
+            COALESCE(records.description, ''),
+            COALESCE(records.content, ''),
+            records.link,
+            COALESCE(records.canonical_link, '')
+        FROM records
+        LEFT JOIN pages ON COALESCE(records.canonical_link, records.link) = pages.canonical_url
+        WHERE pages.url IS NULL AND NOT records.skip_page;
+    `)
 	if err != nil {
 		return nil, err
 	}
@@ -300,14 +600,7 @@ func (s *SqliteStore) GetFeedRecords(feedId string, mdContent bool) ([]internal.
 
 	for rows.Next() {
 		var rec internal.Record
-		err := rows.Scan(
-			&rec.ID,
-			&rec.Title,
-			&rec.Description,
-			&rec.Content,
-			&rec.PublishedAt,
-			&rec.Link,
-		)
+		err := rows.Scan(&rec.ID, &rec.FeedID, &rec.Title, &rec.Description, &rec.Content, &rec.Link, &rec.CanonicalLink)
 		if err != nil {
 			log.Printf("Failed to get row: %v", err)
 			continue
@@ -318,21 +611,1896 @@ func (s *SqliteStore) GetFeedRecords(feedId string, mdContent bool) ([]internal.
 	return result, nil
 }
 
-func NewSqliteStore(dbpath string, logger *log.Logger) (*SqliteStore, error) {
-	// Connect to the SQLite database.
-	db, err := sql.Open("sqlite3", dbpath)
-	if err != nil {
-		return nil, err
+func pageFilterWhere(filter internal.PageFilter) (string, []any) {
+	where := []string{"1 = 1"}
+	args := []any{}
+	if filter.FeedID != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM records r WHERE COALESCE(r.canonical_link, r.link) = p.canonical_url AND r.feed_id = ?)")
+		args = append(args, filter.FeedID)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "p.created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "p.created_at < ?")
+		args = append(args, filter.Until)
+	}
+	if filter.First {
+		where = append(where, "p.page_index = 0")
 	}
+	return strings.Join(where, " AND "), args
+}
 
-	store := SqliteStore{
-		db: db,
-        logger: logger,
+// GetPage returns the latest fetched page with the url or canonical url.
+func (s *SqliteStore) GetPage(url string) (internal.Page, error) {
+	row := s.db.QueryRow(`
+        SELECT
+            url,
+            COALESCE(canonical_url, ''),
+            html,
+            COALESCE(html_hash, ''),
+            COALESCE(content, ''),
+            created_at
+        FROM pages
+        WHERE canonical_url = ? OR url = ?
+        ORDER BY created_at DESC
+        LIMIT 1
+        ;
+    `, url, url)
+
+	var page internal.Page
+	var hash string
+	err := row.Scan(
+		&page.Url,
+		&page.CanonicalUrl,
+		&page.Html,
+		&hash,
+		&page.Content,
+		&page.CreatedAt,
+	)
+	if err != nil {
+		return internal.Page{}, err
+	}
+	err = s.loadHtml(&page, hash)
+	if err != nil {
+		return internal.Page{}, err
 	}
+	return page, nil
+}
+
+func (s *SqliteStore) CountPages(filter internal.PageFilter) (int, error) {
+	where, args := pageFilterWhere(filter)
+	row := s.db.QueryRow(fmt.Sprintf(`
+        SELECT COUNT(*)
+        FROM pages p
+        WHERE %s
+        ;
+    `, where), args...)
 
-	err = store.setup("migrations")
+	var count int
+	err := row.Scan(&count)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *SqliteStore) IteratePages(filter internal.PageFilter, after int64) PageIterator {
+	where, args := pageFilterWhere(filter)
+	return &sqlitePageIterator{
+		store:  s,
+		where:  where,
+		args:   args,
+		cursor: after,
+		size:   50,
+	}
+}
+
+// sqlitePageIterator reads pages in rowid order by small batches, so no
+// query is kept open between calls and the caller may write to the
+// database while iterating.
+type sqlitePageIterator struct {
+	store   *SqliteStore
+	where   string
+	args    []any
+	size    int
+	batch   []internal.Page
+	cursors []int64
+	pos     int
+	cursor  int64
+	done    bool
+	err     error
+}
+
+func (it *sqlitePageIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.pos += 1
+	if it.pos < len(it.batch) {
+		it.cursor = it.cursors[it.pos]
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	it.err = it.fetch()
+	if it.err != nil || len(it.batch) == 0 {
+		return false
+	}
+	it.cursor = it.cursors[it.pos]
+	return true
+}
+
+func (it *sqlitePageIterator) fetch() error {
+	it.batch = it.batch[:0]
+	it.cursors = it.cursors[:0]
+	it.pos = 0
+
+	args := append([]any{it.cursor}, it.args...)
+	args = append(args, it.size)
+	rows, err := it.store.db.Query(fmt.Sprintf(`
+        SELECT
+            p.rowid,
+            p.url,
+            COALESCE(p.canonical_url, ''),
+            p.html,
+            COALESCE(p.html_hash, ''),
+            COALESCE(p.content, ''),
+            p.created_at,
+            COALESCE(p.status, 0),
+            COALESCE(p.request_headers, ''),
+            COALESCE(p.response_headers, ''),
+            p.page_index
+        FROM pages p
+        WHERE p.rowid > ? AND %s
+        ORDER BY p.rowid
+        LIMIT ?
+        ;
+    `, it.where), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var page internal.Page
+		var hash string
+		err := rows.Scan(
+			&id,
+			&page.Url,
+			&page.CanonicalUrl,
+			&page.Html,
+			&hash,
+			&page.Content,
+			&page.CreatedAt,
+			&page.Status,
+			&page.RequestHeaders,
+			&page.ResponseHeaders,
+			&page.Index,
+		)
+		if err != nil {
+			return err
+		}
+		err = it.store.loadHtml(&page, hash)
+		if err != nil {
+			return err
+		}
+		it.batch = append(it.batch, page)
+		it.cursors = append(it.cursors, id)
+	}
+	it.done = len(it.batch) < it.size
+
+	return rows.Err()
+}
+
+func (it *sqlitePageIterator) Page() internal.Page {
+	return it.batch[it.pos]
+}
+
+func (it *sqlitePageIterator) Cursor() int64 {
+	return it.cursor
+}
+
+func (it *sqlitePageIterator) Err() error {
+	return it.err
+}
+
+func (s *SqliteStore) GetCheckpoint(name string) (string, error) {
+	row := s.db.QueryRow(`
+        SELECT value
+        FROM checkpoints
+        WHERE name = ?
+        ;
+    `, name)
+
+	var value string
+	err := row.Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (s *SqliteStore) SetCheckpoint(name string, value string) error {
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        checkpoints(name, value, updated_at)
+        VALUES
+        (?, ?, ?)
+        ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+    `)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(name, value, time.Now())
+	return err
+}
+
+// GetFeedModifiedAt returns the time the newest record of the feed or
+// page of its records was added. It is zero if the feed has no records.
+func (s *SqliteStore) GetFeedModifiedAt(feedId string) (time.Time, error) {
+	var recordAt sql.NullTime
+	err := s.db.QueryRow(`
+        SELECT created_at
+        FROM records
+        WHERE feed_id = ? AND created_at IS NOT NULL
+        ORDER BY created_at DESC
+        LIMIT 1
+        ;
+    `, feedId).Scan(&recordAt)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+
+	var pageAt sql.NullTime
+	err = s.db.QueryRow(`
+        SELECT p.created_at
+        FROM records r
+        JOIN pages p
+        ON p.canonical_url = COALESCE(r.canonical_link, r.link)
+        WHERE r.feed_id = ?
+        ORDER BY p.created_at DESC
+        LIMIT 1
+        ;
+    `, feedId).Scan(&pageAt)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+
+	if pageAt.Time.After(recordAt.Time) {
+		return pageAt.Time, nil
+	}
+	return recordAt.Time, nil
+}
+
+func (s *SqliteStore) GetFeedRecords(feedId string, mdContent bool) ([]internal.Record, error) {
+	log.Print("[WARN] mdContent is not implemented")
+	result := make([]internal.Record, 0)
+	rows, err := s.db.Query(`
+        SELECT
+            r.id,
+            r.title,
+            r.description,
+            p.content,
+            r.published_at,
+            r.link,
+            COALESCE(r.canonical_link, ''),
+            r.read_at,
+            `+recordTagsColumn+`
+        FROM records r
+        JOIN pages p
+        ON p.canonical_url = COALESCE(r.canonical_link, r.link)
+        WHERE r.feed_id = ?
+        ;
+    `, feedId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec internal.Record
+		var readAt sql.NullTime
+		var tags string
+		err := rows.Scan(
+			&rec.ID,
+			&rec.Title,
+			&rec.Description,
+			&rec.Content,
+			&rec.PublishedAt,
+			&rec.Link,
+			&rec.CanonicalLink,
+			&readAt,
+			&tags,
+		)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		rec.ReadAt = readAt.Time
+		rec.Tags = splitTags(tags)
+		result = append(result, rec)
+	}
+
+	return result, nil
+}
+
+// recordColumns selects records aliased as r joined with their feeds
+// aliased as f. Read state is taken from the table aliased as state, which
+// is either records or user_record_state. Content of the latest fetched
+// page replaces the content given by the feed, Extracted tells which one
+// it is.
+func recordColumns(state string) string {
+	return fmt.Sprintf(recordColumnsFormat, state)
+}
+
+const recordColumnsFormat = `
+    r.id,
+    COALESCE(r.num, 0),
+    r.feed_id,
+    COALESCE(r.title, ''),
+    COALESCE(r.description, ''),
+    COALESCE(
+        (SELECT p.content FROM pages p WHERE p.canonical_url = COALESCE(r.canonical_link, r.link) ORDER BY p.created_at DESC LIMIT 1),
+        r.content,
+        ''
+    ),
+    (SELECT p.content FROM pages p WHERE p.canonical_url = COALESCE(r.canonical_link, r.link) ORDER BY p.created_at DESC LIMIT 1) IS NOT NULL,
+    r.published_at,
+    r.link,
+    COALESCE(r.canonical_link, ''),
+    COALESCE(r.story_id, r.id),
+    %[1]s.read_at,
+    %[1]s.starred_at,
+    %[1]s.archived_at,
+    ` + recordTagsColumn + `,
+    f.slug,
+    f.url
+`
+
+func scanRecord(row scanner) (internal.Record, error) {
+	var rec internal.Record
+	var readAt, starredAt, archivedAt sql.NullTime
+	var tags string
+	err := row.Scan(
+		&rec.ID,
+		&rec.Num,
+		&rec.FeedID,
+		&rec.Title,
+		&rec.Description,
+		&rec.Content,
+		&rec.Extracted,
+		&rec.PublishedAt,
+		&rec.Link,
+		&rec.CanonicalLink,
+		&rec.StoryID,
+		&readAt,
+		&starredAt,
+		&archivedAt,
+		&tags,
+		&rec.FeedSlug,
+		&rec.FeedUrl,
+	)
+	if err != nil {
+		return internal.Record{}, err
+	}
+	rec.ReadAt = readAt.Time
+	rec.StarredAt = starredAt.Time
+	rec.ArchivedAt = archivedAt.Time
+	rec.Tags = splitTags(tags)
+	return rec, nil
+}
+
+func (s *SqliteStore) GetRecord(id string) (internal.Record, error) {
+	row := s.db.QueryRow(`
+        SELECT `+recordColumns("r")+`
+        FROM records r
+        JOIN feeds f ON f.id = r.feed_id
+        WHERE r.id = ?
+        LIMIT 1
+        ;
+    `, id)
+	return scanRecord(row)
+}
+
+// recordFilterWhere builds the join of the read state table and the where
+// clause of the filter. State is the alias of the read state table.
+func recordFilterWhere(filter internal.RecordFilter) (string, string, string, []any) {
+	state := "r"
+	join := ""
+	where := []string{"1 = 1"}
+	args := []any{}
+	if filter.UserID != "" {
+		state = "st"
+		join = "LEFT JOIN user_record_state st ON st.record_id = r.id AND st.user_id = ?"
+		where = append(where, "r.feed_id IN (SELECT feed_id FROM subscriptions WHERE user_id = ?)")
+		args = append(args, filter.UserID, filter.UserID)
+	}
+	if len(filter.FeedIDs) > 0 {
+		where = append(where, "r.feed_id IN (?"+strings.Repeat(", ?", len(filter.FeedIDs)-1)+")")
+		for _, id := range filter.FeedIDs {
+			args = append(args, id)
+		}
+	}
+	if filter.GroupID != "" {
+		where = append(where, "r.feed_id IN (SELECT feed_id FROM feed_groups WHERE group_id = ?)")
+		args = append(args, filter.GroupID)
+	}
+	if len(filter.Nums) > 0 {
+		where = append(where, "r.num IN (?"+strings.Repeat(", ?", len(filter.Nums)-1)+")")
+		for _, num := range filter.Nums {
+			args = append(args, num)
+		}
+	}
+	if filter.Unread {
+		where = append(where, fmt.Sprintf("%[1]s.read_at IS NULL AND %[1]s.archived_at IS NULL", state))
+	}
+	if filter.Starred {
+		where = append(where, fmt.Sprintf("%s.starred_at IS NOT NULL", state))
+	}
+	switch {
+	case !filter.Before.IsZero() && filter.BeforeNum > 0:
+		where = append(where, "(r.published_at < ? OR (r.published_at = ? AND r.num < ?))")
+		args = append(args, filter.Before, filter.Before, filter.BeforeNum)
+	case !filter.Before.IsZero():
+		where = append(where, "r.published_at < ?")
+		args = append(args, filter.Before)
+	case filter.BeforeNum > 0:
+		where = append(where, "r.num < ?")
+		args = append(args, filter.BeforeNum)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "r.published_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.AfterNum > 0 {
+		where = append(where, "r.num > ?")
+		args = append(args, filter.AfterNum)
+	}
+	return state, join, strings.Join(where, " AND "), args
+}
+
+// recordFilterOrder orders records newest first, or by sequential ids if
+// the filter pages by them. Records published at the same time are
+// ordered by sequential ids to page through them.
+func recordFilterOrder(filter internal.RecordFilter) string {
+	switch {
+	case filter.AfterNum > 0:
+		return "r.num ASC"
+	case filter.BeforeNum > 0 && filter.Before.IsZero():
+		return "r.num DESC"
+	}
+	return "r.published_at DESC, r.num DESC"
+}
+
+// GetRecords lists records of many feeds newest first.
+func (s *SqliteStore) GetRecords(filter internal.RecordFilter) ([]internal.Record, error) {
+	state, join, where, args := recordFilterWhere(filter)
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT `+recordColumns(state)+`
+        FROM records r
+        JOIN feeds f ON f.id = r.feed_id
+        %s
+        WHERE %s
+        ORDER BY %s
+        LIMIT ?
+        ;
+    `, join, where, recordFilterOrder(filter)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Record, 0)
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, rec)
+	}
+
+	return result, rows.Err()
+}
+
+// CountRecordsByFeed counts records matching the filter in each feed, by
+// feed id. Feeds with no such records are left out. Limit of the filter is
+// ignored.
+func (s *SqliteStore) CountRecordsByFeed(filter internal.RecordFilter) (map[string]int, error) {
+	_, join, where, args := recordFilterWhere(filter)
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT r.feed_id, COUNT(*)
+        FROM records r
+        %s
+        WHERE %s
+        GROUP BY r.feed_id
+        ;
+    `, join, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]int{}
+	for rows.Next() {
+		var feedID string
+		var n int
+		err := rows.Scan(&feedID, &n)
+		if err != nil {
+			return nil, err
+		}
+		result[feedID] = n
+	}
+	return result, rows.Err()
+}
+
+// GetRecordNums lists sequential ids of all records matching the filter.
+// Limit of the filter is ignored.
+func (s *SqliteStore) GetRecordNums(filter internal.RecordFilter) ([]int64, error) {
+	_, join, where, args := recordFilterWhere(filter)
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT r.num
+        FROM records r
+        %s
+        WHERE %s AND r.num IS NOT NULL
+        ORDER BY r.num
+        ;
+    `, join, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]int64, 0)
+	for rows.Next() {
+		var num int64
+		err := rows.Scan(&num)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, num)
+	}
+	return result, rows.Err()
+}
+
+func (s *SqliteStore) AddGroup(name string) (internal.Group, error) {
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        groups(id, num, name, created_at)
+        VALUES
+        (?, (SELECT COALESCE(MAX(num), 0) + 1 FROM groups), ?, ?)
+    `)
+	if err != nil {
+		return internal.Group{}, err
+	}
+
+	group := internal.Group{
+		ID:        uuid.NewString(),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	_, err = stmt.Exec(group.ID, group.Name, group.CreatedAt)
+	if err != nil {
+		return internal.Group{}, err
+	}
+	return s.GetGroupByName(name)
+}
+
+func (s *SqliteStore) GetGroupByName(name string) (internal.Group, error) {
+	var group internal.Group
+	row := s.db.QueryRow(`
+        SELECT id, COALESCE(num, 0), name, created_at
+        FROM groups
+        WHERE name = ?
+        LIMIT 1
+        ;
+    `, name)
+	err := row.Scan(&group.ID, &group.Num, &group.Name, &group.CreatedAt)
+	if err != nil {
+		return internal.Group{}, err
+	}
+	return group, nil
+}
+
+func (s *SqliteStore) GetGroups() ([]internal.Group, error) {
+	rows, err := s.db.Query(`
+        SELECT id, COALESCE(num, 0), name, created_at
+        FROM groups
+        ORDER BY name
+        ;
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Group, 0)
+	for rows.Next() {
+		var group internal.Group
+		err := rows.Scan(&group.ID, &group.Num, &group.Name, &group.CreatedAt)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, group)
+	}
+	return result, nil
+}
+
+func (s *SqliteStore) DeleteGroup(groupID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM feed_groups WHERE group_id = ?`, groupID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM groups WHERE id = ?`, groupID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SqliteStore) AddFeedToGroup(groupID string, feedID string) error {
+	_, err := s.db.Exec(`
+        INSERT OR IGNORE INTO
+        feed_groups(group_id, feed_id)
+        VALUES
+        (?, ?)
+    `, groupID, feedID)
+	return err
+}
+
+func (s *SqliteStore) GetGroupFeeds(groupID string) ([]internal.Feed, error) {
+	rows, err := s.db.Query(`
+        SELECT `+feedColumns+`
+        FROM feeds
+        WHERE id IN (SELECT feed_id FROM feed_groups WHERE group_id = ?)
+        ORDER BY slug
+        ;
+    `, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Feed, 0)
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, feed)
+	}
+	return result, nil
+}
+
+// snippetMarks turns match markers of snippet() to html once the text
+// around them is escaped.
+var snippetMarks = strings.NewReplacer("\x01", "<mark>", "\x02", "</mark>")
+
+// Search finds records matching the FTS5 query, best matches first.
+func (s *SqliteStore) Search(query string, filter internal.SearchFilter) ([]internal.SearchResult, error) {
+	where := []string{"records_search MATCH ?"}
+	args := []any{query}
+	if len(filter.FeedIDs) > 0 {
+		where = append(where, "r.feed_id IN (?"+strings.Repeat(", ?", len(filter.FeedIDs)-1)+")")
+		for _, id := range filter.FeedIDs {
+			args = append(args, id)
+		}
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "r.published_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "r.published_at < ?")
+		args = append(args, filter.Until)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit)
+	order := "records_search.rank"
+	if filter.Newest {
+		order = "r.published_at DESC"
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT
+            r.id,
+            r.feed_id,
+            COALESCE(r.title, ''),
+            COALESCE(r.description, ''),
+            COALESCE(records_search.content, ''),
+            r.published_at,
+            r.link,
+            COALESCE(r.canonical_link, ''),
+            `+recordTagsColumn+`,
+            snippet(records_search, -1, char(1), char(2), '…', 32),
+            records_search.rank
+        FROM records_search
+        JOIN records r ON r.id = records_search.record_id
+        WHERE %s
+        ORDER BY %s
+        LIMIT ?
+        ;
+    `, strings.Join(where, " AND "), order), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.SearchResult, 0)
+	for rows.Next() {
+		var res internal.SearchResult
+		var tags string
+		err := rows.Scan(
+			&res.ID,
+			&res.FeedID,
+			&res.Title,
+			&res.Description,
+			&res.Content,
+			&res.PublishedAt,
+			&res.Link,
+			&res.CanonicalLink,
+			&tags,
+			&res.Snippet,
+			&res.Rank,
+		)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		res.Tags = splitTags(tags)
+		res.Snippet = snippetMarks.Replace(html.EscapeString(res.Snippet))
+		result = append(result, res)
+	}
+
+	return result, rows.Err()
+}
+
+const savedSearchColumns = "id, slug, COALESCE(title, ''), query, COALESCE(feed_ids, ''), since, until, within_ms, created_at"
+
+func scanSavedSearch(row scanner) (internal.SavedSearch, error) {
+	var saved internal.SavedSearch
+	var feedIDs string
+	var since, until sql.NullTime
+	err := row.Scan(
+		&saved.ID,
+		&saved.Slug,
+		&saved.Title,
+		&saved.Query,
+		&feedIDs,
+		&since,
+		&until,
+		&saved.WithinMs,
+		&saved.CreatedAt,
+	)
+	if err != nil {
+		return internal.SavedSearch{}, err
+	}
+	saved.Since = since.Time
+	saved.Until = until.Time
+	if feedIDs != "" {
+		err = json.Unmarshal([]byte(feedIDs), &saved.FeedIDs)
+		if err != nil {
+			return internal.SavedSearch{}, err
+		}
+	}
+	return saved, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (s *SqliteStore) AddSavedSearch(saved internal.SavedSearch) error {
+	feedIDs, err := json.Marshal(saved.FeedIDs)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        saved_searches(id, slug, title, query, feed_ids, since, until, within_ms, created_at)
+        SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?
+        WHERE NOT EXISTS (SELECT 1 FROM feeds WHERE slug = ?)
+    `)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.NewString()
+	now := time.Now()
+	res, err := stmt.Exec(id, saved.Slug, saved.Title, saved.Query, string(feedIDs), nullTime(saved.Since), nullTime(saved.Until), saved.WithinMs, now, saved.Slug)
+	if err != nil {
+		return err
+	}
+	added, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return ErrSlugTaken
+	}
+	return nil
+}
+
+func (s *SqliteStore) GetSavedSearchBySlug(slug string) (internal.SavedSearch, error) {
+	row := s.db.QueryRow(`
+        SELECT `+savedSearchColumns+`
+        FROM saved_searches
+        WHERE slug = ?
+        LIMIT 1
+        ;
+    `, slug)
+	return scanSavedSearch(row)
+}
+
+func (s *SqliteStore) GetSavedSearches() ([]internal.SavedSearch, error) {
+	rows, err := s.db.Query(`
+        SELECT ` + savedSearchColumns + `
+        FROM saved_searches
+        ORDER BY slug
+        ;
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.SavedSearch, 0)
+	for rows.Next() {
+		saved, err := scanSavedSearch(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, saved)
+	}
+	return result, nil
+}
+
+// DeleteSavedSearch deletes the saved search with its hub subscribers.
+func (s *SqliteStore) DeleteSavedSearch(slug string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM saved_searches WHERE slug = ?`, slug)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	_, err = tx.Exec(`DELETE FROM hub_subscriptions WHERE feed = ?`, slug)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+const ruleColumns = `
+    id,
+    COALESCE(feed_id, ''),
+    COALESCE(name, ''),
+    stage,
+    expr,
+    action,
+    COALESCE(field, ''),
+    COALESCE(pattern, ''),
+    COALESCE(value, ''),
+    position,
+    created_at
+`
+
+func scanRule(row scanner) (internal.Rule, error) {
+	var rule internal.Rule
+	err := row.Scan(
+		&rule.ID,
+		&rule.FeedID,
+		&rule.Name,
+		&rule.Stage,
+		&rule.Expr,
+		&rule.Action,
+		&rule.Field,
+		&rule.Pattern,
+		&rule.Value,
+		&rule.Position,
+		&rule.CreatedAt,
+	)
+	return rule, err
+}
+
+func (s *SqliteStore) AddRule(rule internal.Rule) (internal.Rule, error) {
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        rules(id, feed_id, name, stage, expr, action, field, pattern, value, position, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return internal.Rule{}, err
+	}
+
+	rule.ID = uuid.NewString()
+	rule.CreatedAt = time.Now()
+	_, err = stmt.Exec(rule.ID, nullString(rule.FeedID), rule.Name, rule.Stage, rule.Expr, rule.Action, rule.Field, rule.Pattern, rule.Value, rule.Position, rule.CreatedAt)
+	if err != nil {
+		return internal.Rule{}, err
+	}
+	return rule, nil
+}
+
+// GetRules lists rules in the order they are applied. Global rules are
+// listed along with rules of the feed. All rules are listed if the feed is
+// empty.
+func (s *SqliteStore) GetRules(feedID string) ([]internal.Rule, error) {
+	where := "1 = 1"
+	args := []any{}
+	if feedID != "" {
+		where = "feed_id IS NULL OR feed_id = ?"
+		args = append(args, feedID)
+	}
+	rows, err := s.db.Query(`
+        SELECT `+ruleColumns+`
+        FROM rules
+        WHERE `+where+`
+        ORDER BY position, created_at
+        ;
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Rule, 0)
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, rule)
+	}
+	return result, rows.Err()
+}
+
+func (s *SqliteStore) DeleteRule(id string) error {
+	res, err := s.db.Exec(`DELETE FROM rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const userColumns = `id, name, COALESCE(password_hash, ''), COALESCE(fever_key, ''), admin, created_at`
+
+func scanUser(row scanner) (internal.User, error) {
+	var user internal.User
+	err := row.Scan(&user.ID, &user.Name, &user.PasswordHash, &user.FeverKey, &user.Admin, &user.CreatedAt)
+	return user, err
+}
+
+func (s *SqliteStore) AddUser(user internal.User) (internal.User, error) {
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        users(id, name, password_hash, fever_key, admin, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	user.ID = uuid.NewString()
+	user.CreatedAt = time.Now()
+	_, err = stmt.Exec(user.ID, user.Name, nullString(user.PasswordHash), nullString(user.FeverKey), user.Admin, user.CreatedAt)
+	if err != nil {
+		return internal.User{}, err
+	}
+	return user, nil
+}
+
+func (s *SqliteStore) UpdateUserPassword(userID string, passwordHash string) error {
+	_, err := s.db.Exec(`
+        UPDATE users
+        SET password_hash = ?
+        WHERE id = ?
+    `, nullString(passwordHash), userID)
+	return err
+}
+
+// SetUserFeverKey sets the hash of the Fever API key of the user.
+func (s *SqliteStore) SetUserFeverKey(userID string, keyHash string) error {
+	res, err := s.db.Exec(`
+        UPDATE users
+        SET fever_key = ?
+        WHERE id = ?
+    `, nullString(keyHash), userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SqliteStore) FindUserByFeverKey(feverKey string) (internal.User, error) {
+	row := s.db.QueryRow(`
+        SELECT `+userColumns+`
+        FROM users
+        WHERE fever_key = ?
+        LIMIT 1
+        ;
+    `, feverKey)
+	return scanUser(row)
+}
+
+func (s *SqliteStore) GetUserByName(name string) (internal.User, error) {
+	row := s.db.QueryRow(`
+        SELECT `+userColumns+`
+        FROM users
+        WHERE name = ?
+        LIMIT 1
+        ;
+    `, name)
+	return scanUser(row)
+}
+
+func (s *SqliteStore) GetUsers() ([]internal.User, error) {
+	rows, err := s.db.Query(`
+        SELECT ` + userColumns + `
+        FROM users
+        ORDER BY name
+        ;
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, user)
+	}
+	return result, rows.Err()
+}
+
+// DeleteUser deletes the user with tokens, subscriptions and read state.
+func (s *SqliteStore) DeleteUser(userID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"user_record_state", "subscriptions", "tokens"} {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SqliteStore) AddToken(token internal.Token) (internal.Token, error) {
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        tokens(id, user_id, kind, name, token_hash, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return internal.Token{}, err
+	}
+
+	token.ID = uuid.NewString()
+	token.CreatedAt = time.Now()
+	_, err = stmt.Exec(token.ID, token.UserID, token.Kind, token.Name, token.Hash, token.CreatedAt)
+	if err != nil {
+		return internal.Token{}, err
+	}
+	return token, nil
+}
+
+func (s *SqliteStore) GetUserTokens(userID string) ([]internal.Token, error) {
+	rows, err := s.db.Query(`
+        SELECT id, user_id, kind, COALESCE(name, ''), token_hash, created_at, last_used_at
+        FROM tokens
+        WHERE user_id = ?
+        ORDER BY created_at
+        ;
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Token, 0)
+	for rows.Next() {
+		var token internal.Token
+		var lastUsedAt sql.NullTime
+		err := rows.Scan(&token.ID, &token.UserID, &token.Kind, &token.Name, &token.Hash, &token.CreatedAt, &lastUsedAt)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		token.LastUsedAt = lastUsedAt.Time
+		result = append(result, token)
+	}
+	return result, rows.Err()
+}
+
+func (s *SqliteStore) DeleteToken(id string) error {
+	res, err := s.db.Exec(`DELETE FROM tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// tokenUseInterval is how often last use of a token is written. Clients
+// polling with the token do not write on every request.
+const tokenUseInterval = time.Minute
+
+// FindUserByToken returns the owner of the token of the kind with the hash
+// and notes the token was used, at most once in tokenUseInterval.
+func (s *SqliteStore) FindUserByToken(hash string, kind string) (internal.User, error) {
+	row := s.db.QueryRow(`
+        SELECT `+userColumns+`
+        FROM users
+        WHERE id = (SELECT user_id FROM tokens WHERE token_hash = ? AND kind = ?)
+        LIMIT 1
+        ;
+    `, hash, kind)
+	user, err := scanUser(row)
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	now := time.Now()
+	_, err = s.db.Exec(`
+        UPDATE tokens
+        SET last_used_at = ?
+        WHERE token_hash = ? AND (last_used_at IS NULL OR last_used_at < ?)
+    `, now, hash, now.Add(-tokenUseInterval))
+	if err != nil {
+		log.Printf("Failed to update token: %v", err)
+	}
+	return user, nil
+}
+
+func (s *SqliteStore) AddSubscription(userID string, feedID string) error {
+	_, err := s.db.Exec(`
+        INSERT OR IGNORE INTO
+        subscriptions(user_id, feed_id, created_at)
+        VALUES
+        (?, ?, ?)
+    `, userID, feedID, time.Now())
+	return err
+}
+
+func (s *SqliteStore) DeleteSubscription(userID string, feedID string) error {
+	res, err := s.db.Exec(`DELETE FROM subscriptions WHERE user_id = ? AND feed_id = ?`, userID, feedID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SqliteStore) GetSubscriptions(userID string) ([]internal.Feed, error) {
+	rows, err := s.db.Query(`
+        SELECT `+feedColumns+`
+        FROM feeds
+        WHERE id IN (SELECT feed_id FROM subscriptions WHERE user_id = ?)
+        ORDER BY slug
+        ;
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Feed, 0)
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, feed)
+	}
+	return result, rows.Err()
+}
+
+var stateColumns = map[string]string{
+	internal.RecordStateRead:     "read_at",
+	internal.RecordStateStarred:  "starred_at",
+	internal.RecordStateArchived: "archived_at",
+}
+
+// SetUserRecordState sets the state of the record for the user to now,
+// keeping the time it was set first, or clears it.
+func (s *SqliteStore) SetUserRecordState(userID string, recordID string, state string, on bool) error {
+	column, ok := stateColumns[state]
+	if !ok {
+		return fmt.Errorf("unknown state %q", state)
+	}
+
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM records WHERE id = ?)`, recordID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	var value sql.NullTime
+	if on {
+		value = nullTime(time.Now())
+	}
+	_, err = s.db.Exec(fmt.Sprintf(`
+        INSERT INTO
+        user_record_state(user_id, record_id, %[1]s)
+        VALUES
+        (?, ?, ?)
+        ON CONFLICT (user_id, record_id) DO UPDATE
+        SET %[1]s = CASE WHEN ? THEN COALESCE(%[1]s, excluded.%[1]s) ELSE NULL END
+    `, column), userID, recordID, value, on)
+	return err
+}
+
+// MarkUserFeedRead marks records of the feed published before the time as
+// read for the user. It returns the number of records marked.
+func (s *SqliteStore) MarkUserFeedRead(userID string, feedID string, before time.Time) (int64, error) {
+	res, err := s.db.Exec(`
+        INSERT INTO
+        user_record_state(user_id, record_id, read_at)
+        SELECT ?, id, ?
+        FROM records
+        WHERE feed_id = ? AND published_at < ?
+            AND id NOT IN (SELECT record_id FROM user_record_state WHERE user_id = ? AND read_at IS NOT NULL)
+        ON CONFLICT (user_id, record_id) DO UPDATE
+        SET read_at = excluded.read_at
+    `, userID, time.Now(), feedID, before, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// MarkSubscribersRead marks the record read for every user subscribed to
+// its feed. Rules mark records read this way, as signed in users see their
+// own read state only.
+func (s *SqliteStore) MarkSubscribersRead(recordID string) error {
+	_, err := s.db.Exec(`
+        INSERT INTO
+        user_record_state(user_id, record_id, read_at)
+        SELECT sub.user_id, r.id, ?
+        FROM records r
+        JOIN subscriptions sub ON sub.feed_id = r.feed_id
+        WHERE r.id = ?
+        ON CONFLICT (user_id, record_id) DO UPDATE
+        SET read_at = COALESCE(read_at, excluded.read_at)
+    `, time.Now(), recordID)
+	return err
+}
+
+func (s *SqliteStore) AddWebhook(hook internal.Webhook) (internal.Webhook, error) {
+	feeds, err := json.Marshal(hook.Feeds)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	tags, err := json.Marshal(hook.Tags)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	types, err := json.Marshal(hook.Events)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        webhooks(id, url, secret, feeds, tags, events, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+
+	hook.ID = uuid.NewString()
+	hook.CreatedAt = time.Now()
+	_, err = stmt.Exec(hook.ID, hook.Url, hook.Secret, string(feeds), string(tags), string(types), hook.CreatedAt)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	return hook, nil
+}
+
+func scanWebhook(row scanner) (internal.Webhook, error) {
+	var hook internal.Webhook
+	var feeds, tags, types string
+	err := row.Scan(
+		&hook.ID,
+		&hook.Url,
+		&hook.Secret,
+		&feeds,
+		&tags,
+		&types,
+		&hook.CreatedAt,
+	)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	for _, list := range []struct {
+		value string
+		dest  *[]string
+	}{
+		{feeds, &hook.Feeds},
+		{tags, &hook.Tags},
+		{types, &hook.Events},
+	} {
+		if list.value == "" {
+			continue
+		}
+		err = json.Unmarshal([]byte(list.value), list.dest)
+		if err != nil {
+			return internal.Webhook{}, err
+		}
+	}
+	return hook, nil
+}
+
+func (s *SqliteStore) GetWebhooks() ([]internal.Webhook, error) {
+	rows, err := s.db.Query(`
+        SELECT id, url, secret, COALESCE(feeds, ''), COALESCE(tags, ''), COALESCE(events, ''), created_at
+        FROM webhooks
+        ORDER BY created_at
+        ;
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, hook)
+	}
+	return result, rows.Err()
+}
+
+// DeleteWebhook deletes the webhook with its delivery log and events not
+// delivered yet.
+func (s *SqliteStore) DeleteWebhook(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM webhook_outbox WHERE webhook_id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (s *SqliteStore) AddWebhookDelivery(delivery internal.WebhookDelivery) error {
+	stmt, err := s.db.Prepare(`
+        INSERT INTO
+        webhook_deliveries(id, webhook_id, delivery_id, event_type, attempt, status, error, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return err
+	}
+
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	_, err = stmt.Exec(uuid.NewString(), delivery.WebhookID, delivery.DeliveryID, delivery.EventType, delivery.Attempt, delivery.Status, nullString(delivery.Error), delivery.CreatedAt)
+	return err
+}
+
+// DeleteWebhookDeliveries deletes delivery attempts made before the time
+// from the delivery log.
+func (s *SqliteStore) DeleteWebhookDeliveries(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM webhook_deliveries WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// AddWebhookEvents puts the events to the outbox at once.
+func (s *SqliteStore) AddWebhookEvents(list []internal.WebhookEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+        INSERT INTO
+        webhook_outbox(webhook_id, delivery_id, event_type, payload, attempts, next_attempt_at, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, e := range list {
+		if e.NextAttemptAt.IsZero() {
+			e.NextAttemptAt = now
+		}
+		_, err = stmt.Exec(e.WebhookID, e.DeliveryID, e.EventType, e.Payload, e.Attempts, e.NextAttemptAt, now)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDueWebhookEvents lists events of the outbox to be delivered by the
+// time, oldest first.
+func (s *SqliteStore) GetDueWebhookEvents(now time.Time, limit int) ([]internal.WebhookEvent, error) {
+	rows, err := s.db.Query(`
+        SELECT id, webhook_id, delivery_id, event_type, payload, attempts, next_attempt_at, created_at
+        FROM webhook_outbox
+        WHERE next_attempt_at <= ?
+        ORDER BY id
+        LIMIT ?
+        ;
+    `, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.WebhookEvent, 0)
+	for rows.Next() {
+		var e internal.WebhookEvent
+		err := rows.Scan(&e.ID, &e.WebhookID, &e.DeliveryID, &e.EventType, &e.Payload, &e.Attempts, &e.NextAttemptAt, &e.CreatedAt)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// UpdateWebhookEvent saves attempts made to deliver the event and the
+// time of the next one.
+func (s *SqliteStore) UpdateWebhookEvent(e internal.WebhookEvent) error {
+	res, err := s.db.Exec(`
+        UPDATE webhook_outbox
+        SET attempts = ?, next_attempt_at = ?
+        WHERE id = ?
+    `, e.Attempts, e.NextAttemptAt, e.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteWebhookEvent takes the delivered event out of the outbox.
+func (s *SqliteStore) DeleteWebhookEvent(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM webhook_outbox WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetWebhookDeliveries lists recent delivery attempts of the webhook,
+// newest first.
+func (s *SqliteStore) GetWebhookDeliveries(webhookID string, limit int) ([]internal.WebhookDelivery, error) {
+	rows, err := s.db.Query(`
+        SELECT id, webhook_id, delivery_id, event_type, attempt, status, COALESCE(error, ''), created_at
+        FROM webhook_deliveries
+        WHERE webhook_id = ?
+        ORDER BY created_at DESC
+        LIMIT ?
+        ;
+    `, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.WebhookDelivery, 0)
+	for rows.Next() {
+		var d internal.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.DeliveryID, &d.EventType, &d.Attempt, &d.Status, &d.Error, &d.CreatedAt)
+		if err != nil {
+			log.Printf("Failed to get row: %v", err)
+			continue
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+// SaveWebSubSubscription adds the subscription of the feed or replaces
+// the existing one.
+func (s *SqliteStore) SaveWebSubSubscription(sub internal.WebSubSubscription) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO
+        websub_subscriptions(feed_id, hub, topic, secret, state, requested, lease_seconds, expires_at, error, updated_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, sub.FeedID, sub.Hub, sub.Topic, sub.Secret, sub.State, sub.Requested, sub.Lease, nullTime(sub.ExpiresAt), nullString(sub.Error), time.Now())
+	return err
+}
+
+func (s *SqliteStore) GetWebSubSubscription(feedID string) (internal.WebSubSubscription, error) {
+	var sub internal.WebSubSubscription
+	var expiresAt sql.NullTime
+	err := s.db.QueryRow(`
+        SELECT feed_id, hub, topic, secret, state, requested, lease_seconds, expires_at, COALESCE(error, ''), updated_at
+        FROM websub_subscriptions
+        WHERE feed_id = ?
+        LIMIT 1
+        ;
+    `, feedID).Scan(&sub.FeedID, &sub.Hub, &sub.Topic, &sub.Secret, &sub.State, &sub.Requested, &sub.Lease, &expiresAt, &sub.Error, &sub.UpdatedAt)
+	if err != nil {
+		return internal.WebSubSubscription{}, err
+	}
+	sub.ExpiresAt = expiresAt.Time
+	return sub, nil
+}
+
+func (s *SqliteStore) DeleteWebSubSubscription(feedID string) error {
+	_, err := s.db.Exec(`DELETE FROM websub_subscriptions WHERE feed_id = ?`, feedID)
+	return err
+}
+
+// SaveHubSubscription adds the subscriber of the feed or renews its
+// lease.
+func (s *SqliteStore) SaveHubSubscription(sub internal.HubSubscription) error {
+	_, err := s.db.Exec(`
+        INSERT INTO
+        hub_subscriptions(feed, format, callback, secret, lease_seconds, expires_at, created_at)
+        VALUES
+        (?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(feed, format, callback) DO UPDATE SET
+            secret = excluded.secret,
+            lease_seconds = excluded.lease_seconds,
+            expires_at = excluded.expires_at
+    `, sub.Feed, sub.Format, sub.Callback, sub.Secret, sub.Lease, sub.ExpiresAt, time.Now())
+	return err
+}
+
+func (s *SqliteStore) DeleteHubSubscription(feed string, format string, callback string) error {
+	res, err := s.db.Exec(`DELETE FROM hub_subscriptions WHERE feed = ? AND format = ? AND callback = ?`, feed, format, callback)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SqliteStore) GetHubSubscriptions() ([]internal.HubSubscription, error) {
+	rows, err := s.db.Query(`
+        SELECT feed, format, callback, secret, lease_seconds, expires_at, created_at
+        FROM hub_subscriptions
+        ORDER BY feed, format, created_at
+        ;
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]internal.HubSubscription, 0)
+	for rows.Next() {
+		var sub internal.HubSubscription
+		err = rows.Scan(&sub.Feed, &sub.Format, &sub.Callback, &sub.Secret, &sub.Lease, &sub.ExpiresAt, &sub.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sub)
+	}
+	return result, rows.Err()
+}
+
+// DeleteExpiredHubSubscriptions deletes subscriptions with leases expired
+// before the time and returns the number of deleted ones.
+func (s *SqliteStore) DeleteExpiredHubSubscriptions(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM hub_subscriptions WHERE expires_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// loadHtml resolves html of pages moved to the blob store. Pages stored
+// before the blob store existed keep their html inline.
+func (s *SqliteStore) loadHtml(page *internal.Page, hash string) error {
+	if hash == "" {
+		return nil
+	}
+	data, err := s.blobs.Get(hash)
+	if err != nil {
+		return err
+	}
+	page.Html = string(data)
+	return nil
+}
+
+// MovePagesToBlobs moves inline html of pages to the blob store in batches
+// and returns the number of moved pages.
+func (s *SqliteStore) MovePagesToBlobs(batchSize int) (int, error) {
+	total := 0
+	for {
+		rows, err := s.db.Query(`
+            SELECT rowid, html
+            FROM pages
+            WHERE html_hash IS NULL
+            LIMIT ?
+            ;
+        `, batchSize)
+		if err != nil {
+			return total, err
+		}
+
+		type inline struct {
+			id   int64
+			html string
+		}
+		batch := make([]inline, 0, batchSize)
+		for rows.Next() {
+			var p inline
+			err := rows.Scan(&p.id, &p.html)
+			if err != nil {
+				rows.Close()
+				return total, err
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return total, err
+		}
+		for _, p := range batch {
+			hash, err := s.blobs.Put([]byte(p.html))
+			if err != nil {
+				tx.Rollback()
+				return total, err
+			}
+			_, err = tx.Exec(`UPDATE pages SET html = '', html_hash = ? WHERE rowid = ?`, hash, p.id)
+			if err != nil {
+				tx.Rollback()
+				return total, err
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			return total, err
+		}
+
+		total += len(batch)
+		s.logger.Printf("Moved %d pages to blob store", total)
+	}
+}
+
+// FillRecordLinkKeys sets link keys of records added before records had
+// them, in batches. The key is made of the link by the function. It
+// returns the number of filled records.
+func (s *SqliteStore) FillRecordLinkKeys(key func(string) string, batchSize int) (int, error) {
+	total := 0
+	for {
+		rows, err := s.db.Query(`
+            SELECT id, link
+            FROM records
+            WHERE link_key IS NULL
+            LIMIT ?
+            ;
+        `, batchSize)
+		if err != nil {
+			return total, err
+		}
+
+		type link struct {
+			id   string
+			link string
+		}
+		batch := make([]link, 0, batchSize)
+		for rows.Next() {
+			var l link
+			err := rows.Scan(&l.id, &l.link)
+			if err != nil {
+				rows.Close()
+				return total, err
+			}
+			batch = append(batch, l)
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return total, err
+		}
+		for _, l := range batch {
+			_, err = tx.Exec(`UPDATE records SET link_key = ? WHERE id = ?`, key(l.link), l.id)
+			if err != nil {
+				tx.Rollback()
+				return total, err
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			return total, err
+		}
+
+		total += len(batch)
+		s.logger.Printf("Filled link keys of %d records", total)
+	}
+}
+
+// Vacuum rebuilds the database file to give space of deleted data back.
+func (s *SqliteStore) Vacuum() error {
+	_, err := s.db.Exec("VACUUM")
+	return err
+}
+
+func NewSqliteStore(dbpath string, blobs blob.Store, logger *log.Logger) (*SqliteStore, error) {
+	store, err := openSqliteStore(dbpath, "migrations", blobs, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return store, nil
+}
+
+// openSqliteStore connects to the database and migrates it with the
+// migrations found at migrationsPath.
+func openSqliteStore(dbpath string, migrationsPath string, blobs blob.Store, logger *log.Logger) (*SqliteStore, error) {
+	// Connect to the SQLite database.
+	db, err := sql.Open("sqlite3", dbpath)
+	if err != nil {
+		return nil, err
+	}
+
+	store := SqliteStore{
+		db:     instrumentedDB{db},
+		blobs:  blobs,
+		logger: logger,
+	}
+
+	err = store.setup(migrationsPath)
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return &store, nil
@@ -0,0 +1,137 @@
+//go:build sqlite_fts5
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmshv/feeder/internal"
+)
+
+func TestAddFeedSlugTaken(t *testing.T) {
+	s := newTestStore(t)
+	addTestFeed(t, s, "news")
+	err := s.AddSavedSearch(internal.SavedSearch{Slug: "rust", Query: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.AddFeed("rust", "https://example.com/rust.xml")
+	if err != ErrSlugTaken {
+		t.Errorf("AddFeed() of a saved search slug = %v, want %v", err, ErrSlugTaken)
+	}
+	_, err = s.GetFeedBySlug("rust")
+	if err == nil {
+		t.Error("Added the feed with a saved search slug")
+	}
+
+	err = s.AddSavedSearch(internal.SavedSearch{Slug: "news", Query: "news"})
+	if err != ErrSlugTaken {
+		t.Errorf("AddSavedSearch() of a feed slug = %v, want %v", err, ErrSlugTaken)
+	}
+	_, err = s.GetSavedSearchBySlug("news")
+	if err == nil {
+		t.Error("Added the saved search with a feed slug")
+	}
+}
+
+func TestMarkSubscribersRead(t *testing.T) {
+	s := newTestStore(t)
+	feed := addTestFeed(t, s, "news")
+	alice, err := s.AddUser(internal.User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.AddUser(internal.User{Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []internal.User{alice, bob} {
+		err = s.AddSubscription(user.ID, feed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addTestRecord(t, s, internal.Record{ID: "a", FeedID: feed.ID, Title: "Sponsored", Link: "https://example.com/a", PublishedAt: time.Now()})
+	addTestRecord(t, s, internal.Record{ID: "b", FeedID: feed.ID, Title: "News", Link: "https://example.com/b", PublishedAt: time.Now()})
+
+	// Bob has read and starred the record before.
+	err = s.SetUserRecordState(bob.ID, "a", internal.RecordStateStarred, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.MarkSubscribersRead("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []internal.User{alice, bob} {
+		unread, err := s.GetRecords(internal.RecordFilter{UserID: user.ID, Unread: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(unread) != 1 || unread[0].ID != "b" {
+			t.Errorf("Unread records of %s = %v, want [b]", user.Name, recordIDs(unread))
+		}
+	}
+	starred, err := s.GetRecords(internal.RecordFilter{UserID: bob.ID, Starred: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(starred) != 1 {
+		t.Errorf("Starred records of bob = %v, want [a]", recordIDs(starred))
+	}
+}
+
+func recordIDs(records []internal.Record) []string {
+	ids := make([]string, 0, len(records))
+	for _, rec := range records {
+		ids = append(ids, rec.ID)
+	}
+	return ids
+}
+
+func TestHubSubscriptionsOfGoneFeeds(t *testing.T) {
+	s := newTestStore(t)
+	news := addTestFeed(t, s, "news")
+	blog := addTestFeed(t, s, "blog")
+	tech := addTestFeed(t, s, "tech")
+	err := s.AddSavedSearch(internal.SavedSearch{Slug: "rust", Query: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slug := range []string{"news", "blog", "tech", "rust"} {
+		err = s.SaveHubSubscription(internal.HubSubscription{Feed: slug, Callback: "https://example.com/" + slug, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.DeleteFeed(news.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog.Slug = "weblog"
+	err = s.UpdateFeed(blog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tech.RefreshMs = 60000
+	err = s.UpdateFeed(tech)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.DeleteSavedSearch("rust")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := s.GetHubSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Feed != "tech" {
+		t.Errorf("Hub subscriptions = %+v, want the one of tech", subs)
+	}
+}
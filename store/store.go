@@ -1,18 +1,100 @@
 package store
 
 import (
+	"time"
+
 	. "github.com/tmshv/feeder/internal"
 )
 
 type Store interface {
 	AddFeed(string, string) error
-	AddPage(string, string, string) error
-	UpdatePageContent(*Page, string) error
+	AddPage(Page) error
+	UpdatePageArticle(*Page, string, string) error
 	GetFeedBySlug(string) (Feed, error)
+	GetFeedByID(string) (Feed, error)
 	FindFeedByUrl(string) (Feed, error)
+	FindRecordByPageUrl(string) (Record, error)
 	GetFeeds() ([]Feed, error)
+	UpdateFeedExtractRules(string, ExtractRules) error
+	UpdateFeed(Feed) error
+	DeleteFeed(string) error
 	AddRecord(Record) (int64, error)
-	FindRecordsWithNoPage() ([]string, error)
-	GetAllPages() ([]Page, error)
+	FindRecordsWithNoPage() ([]Record, error)
+	HasRecordLink(string, string) (bool, error)
+	UpdateRecordCanonicalLink(string, string) error
+	SetRecordStory(string, uint64, string) error
+	GetStoryCandidates(string, time.Time, time.Time) ([]Record, error)
+	AddRecordTags(string, []string) error
+	SetRecordRead(string, bool) error
+	SetRecordStarred(string, bool) error
+	SetRecordArchived(string, bool) error
+	MarkFeedRead(string, time.Time) (int64, error)
+	GetPage(string) (Page, error)
+	CountPages(PageFilter) (int, error)
+	IteratePages(PageFilter, int64) PageIterator
 	GetFeedRecords(string, bool) ([]Record, error)
+	GetFeedModifiedAt(string) (time.Time, error)
+	GetRecord(string) (Record, error)
+	GetRecords(RecordFilter) ([]Record, error)
+	GetRecordNums(RecordFilter) ([]int64, error)
+	CountRecordsByFeed(RecordFilter) (map[string]int, error)
+	AddGroup(string) (Group, error)
+	GetGroupByName(string) (Group, error)
+	GetGroups() ([]Group, error)
+	DeleteGroup(string) error
+	AddFeedToGroup(string, string) error
+	GetGroupFeeds(string) ([]Feed, error)
+	Search(string, SearchFilter) ([]SearchResult, error)
+	AddSavedSearch(SavedSearch) error
+	GetSavedSearchBySlug(string) (SavedSearch, error)
+	GetSavedSearches() ([]SavedSearch, error)
+	DeleteSavedSearch(string) error
+	AddRule(Rule) (Rule, error)
+	GetRules(string) ([]Rule, error)
+	DeleteRule(string) error
+	AddUser(User) (User, error)
+	UpdateUserPassword(string, string) error
+	SetUserFeverKey(string, string) error
+	GetUserByName(string) (User, error)
+	FindUserByFeverKey(string) (User, error)
+	GetUsers() ([]User, error)
+	DeleteUser(string) error
+	AddToken(Token) (Token, error)
+	GetUserTokens(string) ([]Token, error)
+	DeleteToken(string) error
+	FindUserByToken(string, string) (User, error)
+	AddSubscription(string, string) error
+	DeleteSubscription(string, string) error
+	GetSubscriptions(string) ([]Feed, error)
+	SetUserRecordState(string, string, string, bool) error
+	MarkUserFeedRead(string, string, time.Time) (int64, error)
+	MarkSubscribersRead(string) error
+	AddWebhook(Webhook) (Webhook, error)
+	GetWebhooks() ([]Webhook, error)
+	DeleteWebhook(string) error
+	AddWebhookDelivery(WebhookDelivery) error
+	AddWebhookEvents([]WebhookEvent) error
+	GetDueWebhookEvents(time.Time, int) ([]WebhookEvent, error)
+	UpdateWebhookEvent(WebhookEvent) error
+	DeleteWebhookEvent(int64) error
+	GetWebhookDeliveries(string, int) ([]WebhookDelivery, error)
+	DeleteWebhookDeliveries(time.Time) (int64, error)
+	SaveWebSubSubscription(WebSubSubscription) error
+	GetWebSubSubscription(string) (WebSubSubscription, error)
+	DeleteWebSubSubscription(string) error
+	SaveHubSubscription(HubSubscription) error
+	DeleteHubSubscription(string, string, string) error
+	GetHubSubscriptions() ([]HubSubscription, error)
+	DeleteExpiredHubSubscriptions(time.Time) (int64, error)
+	GetCheckpoint(string) (string, error)
+	SetCheckpoint(string, string) error
+}
+
+// PageIterator streams pages one by one. Cursor of the current page can be
+// passed to IteratePages later to continue after it.
+type PageIterator interface {
+	Next() bool
+	Page() Page
+	Cursor() int64
+	Err() error
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tmshv/feeder/dedup"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+// storyWindow is how far apart records of the same story may be published.
+const storyWindow = 72 * time.Hour
+
+func recordLink(rec internal.Record) string {
+	if rec.CanonicalLink != "" {
+		return rec.CanonicalLink
+	}
+	return rec.Link
+}
+
+// assignStory fingerprints the text of the record and joins it to the
+// story of a record with the same link or similar text. The record starts
+// a story of its own if nothing matches.
+func assignStory(db store.Store, rec internal.Record, text string) error {
+	hash := dedup.SimHash(text)
+	records, err := db.GetStoryCandidates(rec.ID, rec.PublishedAt.Add(-storyWindow), rec.PublishedAt.Add(storyWindow))
+	if err != nil {
+		return err
+	}
+
+	candidates := make([]dedup.Candidate, 0, len(records))
+	for _, r := range records {
+		candidates = append(candidates, dedup.Candidate{
+			StoryID: r.StoryID,
+			Link:    recordLink(r),
+			Hash:    r.Simhash,
+		})
+	}
+	storyID, _ := dedup.Match(recordLink(rec), hash, candidates)
+	return db.SetRecordStory(rec.ID, hash, storyID)
+}
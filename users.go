@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+func addUser(db store.Store, name string, password string, admin bool) error {
+	user := internal.User{
+		Name:  name,
+		Admin: admin,
+	}
+	if password != "" {
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = hash
+	}
+	_, err := db.AddUser(user)
+	return err
+}
+
+// bootstrapAdmin adds the admin user with a random password if there are
+// no users yet, so feeders of versions serving everyone without
+// authentication stay reachable. The admin is subscribed to all feeds and
+// the password is logged once.
+func bootstrapAdmin(db store.Store) error {
+	users, err := db.GetUsers()
+	if err != nil || len(users) > 0 {
+		return err
+	}
+	password, _, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user, err := db.AddUser(internal.User{
+		Name:         "admin",
+		PasswordHash: hash,
+		Admin:        true,
+	})
+	if err != nil {
+		return err
+	}
+	feeds, err := db.GetFeeds()
+	if err != nil {
+		return err
+	}
+	for _, feed := range feeds {
+		err = db.AddSubscription(user.ID, feed.ID)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Added user admin with password %s, change it with: feeder user password admin --password <new>", password)
+	return nil
+}
+
+func setUserPassword(db store.Store, name string, password string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	hash := ""
+	if password != "" {
+		hash, err = auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+	}
+	return db.UpdateUserPassword(user.ID, hash)
+}
+
+// setFeverPassword makes a new password of Fever API clients of the user
+// and prints it. The previous one stops working.
+func setFeverPassword(db store.Store, name string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	password, hash, err := auth.NewFeverPassword(user.Name)
+	if err != nil {
+		return err
+	}
+	err = db.SetUserFeverKey(user.ID, hash)
+	if err != nil {
+		return err
+	}
+	fmt.Println(password)
+	return nil
+}
+
+func listUsers(db store.Store) error {
+	users, err := db.GetUsers()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		feeds, err := db.GetSubscriptions(user.ID)
+		if err != nil {
+			return err
+		}
+		role := "user"
+		if user.Admin {
+			role = "admin"
+		}
+		fmt.Printf("%s\t%s\t%d feeds\n", user.Name, role, len(feeds))
+	}
+	return nil
+}
+
+func removeUser(db store.Store, name string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	return db.DeleteUser(user.ID)
+}
+
+// addToken makes a token of the user and prints it. The token cannot be
+// shown again. Feed tokens are printed as private feed URLs.
+func addToken(db store.Store, name string, kind string, tokenName string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	secret, hash, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	_, err = db.AddToken(internal.Token{
+		UserID: user.ID,
+		Kind:   kind,
+		Name:   tokenName,
+		Hash:   hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(secret)
+	if kind == internal.TokenKindFeed {
+		fmt.Printf("%s/u/%s/all\n", baseUrl, secret)
+	}
+	return nil
+}
+
+func listTokens(db store.Store, name string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	tokens, err := db.GetUserTokens(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		used := "never used"
+		if !token.LastUsedAt.IsZero() {
+			used = "used " + token.LastUsedAt.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", token.ID, token.Kind, token.Name, used)
+	}
+	return nil
+}
+
+// findOrAddFeed returns the feed with the slug or URL. Feeds are shared,
+// so a URL nobody follows yet is added as a new feed.
+func findOrAddFeed(db store.Store, value string) (internal.Feed, error) {
+	if !strings.Contains(value, "://") {
+		return db.GetFeedBySlug(value)
+	}
+
+	feed, err := db.FindFeedByUrl(value)
+	if err == nil {
+		return feed, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return internal.Feed{}, err
+	}
+	err = db.AddFeed(slugify(u.Host+u.Path), value)
+	if err != nil {
+		return internal.Feed{}, err
+	}
+	return db.FindFeedByUrl(value)
+}
+
+func subscribe(db store.Store, name string, feeds []string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	for _, value := range feeds {
+		feed, err := findOrAddFeed(db, value)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", value, err)
+		}
+		err = db.AddSubscription(user.ID, feed.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unsubscribe(db store.Store, name string, slugs []string) error {
+	user, err := db.GetUserByName(name)
+	if err != nil {
+		return err
+	}
+	for _, slug := range slugs {
+		feed, err := db.GetFeedBySlug(slug)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", slug, err)
+		}
+		err = db.DeleteSubscription(user.ID, feed.ID)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", slug, err)
+		}
+	}
+	return nil
+}
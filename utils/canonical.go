@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultDropParams are tracking query parameters that never change the
+// page. A trailing * matches any suffix.
+var DefaultDropParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"yclid",
+	"msclkid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+	"__hstc",
+	"__hssc",
+	"__hsfp",
+	"mkt_tok",
+	"ref",
+	"ref_src",
+	"ref_url",
+	"referrer",
+	"spm",
+	"amp",
+	"outputtype",
+}
+
+// Canonicalizer rewrites URLs to one form so the same page linked in
+// different ways is stored once.
+type Canonicalizer struct {
+	// DropParams are query parameters to remove, compared case-insensitively.
+	DropParams []string
+	// Https upgrades http links.
+	Https bool
+	// KeepFragment keeps the #fragment, it is dropped otherwise.
+	KeepFragment bool
+	// Amp resolves AMP cache and /amp links to the original page.
+	Amp bool
+}
+
+// DefaultCanonicalizer is used by Canonical.
+var DefaultCanonicalizer = NewCanonicalizer()
+
+// NewCanonicalizer makes a canonicalizer dropping the default parameters
+// along with the extra ones.
+func NewCanonicalizer(extra ...string) *Canonicalizer {
+	params := make([]string, 0, len(DefaultDropParams)+len(extra))
+	params = append(params, DefaultDropParams...)
+	params = append(params, extra...)
+	return &Canonicalizer{
+		DropParams: params,
+		Https:      true,
+		Amp:        true,
+	}
+}
+
+// Canonical rewrites the URL with the default canonicalizer.
+func Canonical(urlStr string) string {
+	return DefaultCanonicalizer.Canonical(urlStr)
+}
+
+func (c *Canonicalizer) drop(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range c.DropParams {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Canonical rewrites the URL. Hosts are lowercased, default ports and
+// tracking parameters are dropped and the rest of the query is sorted.
+// URLs that fail to parse are returned as they are.
+func (c *Canonicalizer) Canonical(urlStr string) string {
+	u, err := url.Parse(strings.TrimSpace(urlStr))
+	if err != nil || u.Host == "" {
+		return urlStr
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if c.Https && u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == "" || (port == "80" && u.Scheme == "http") || (port == "443" && u.Scheme == "https") || (port == "80" && c.Https) {
+		u.Host = host
+	} else {
+		u.Host = host + ":" + port
+	}
+	if !c.KeepFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if c.Amp {
+		unwrapAmp(u)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if !c.drop(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(v))
+		}
+	}
+	u.RawQuery = strings.Join(parts, "&")
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// unwrapAmp turns AMP cache links like
+// https://example-com.cdn.ampproject.org/c/s/example.com/a and AMP versions
+// like https://amp.example.com/a/amp into the original page. AMP paths, a
+// trailing /amp, an amp/ prefix or an .amp suffix, are removed from links
+// known to be AMP only: of AMP caches, amp. hosts or with ?amp=1. Other
+// paths may name amp legitimately, like /tags/amp.
+func unwrapAmp(u *url.URL) {
+	known := strings.HasPrefix(u.Host, "amp.") || u.Query().Get("amp") == "1"
+	if strings.HasSuffix(u.Host, ".cdn.ampproject.org") {
+		known = true
+		p := strings.TrimPrefix(u.Path, "/")
+		for _, prefix := range []string{"c/", "v/", "i/"} {
+			p = strings.TrimPrefix(p, prefix)
+		}
+		p = strings.TrimPrefix(p, "s/")
+		host, rest, _ := strings.Cut(p, "/")
+		if host != "" {
+			u.Host = host
+			u.Path = "/" + rest
+		}
+	}
+
+	if !known {
+		return
+	}
+	trimmed := strings.TrimSuffix(u.Path, "/")
+	switch {
+	case path.Base(trimmed) == "amp":
+		u.Path = strings.TrimSuffix(trimmed, "amp")
+	case strings.HasPrefix(u.Path, "/amp/"):
+		u.Path = strings.TrimPrefix(u.Path, "/amp")
+	case strings.HasSuffix(trimmed, ".amp"):
+		u.Path = strings.TrimSuffix(trimmed, ".amp")
+	}
+}
+
+// CanonicalFromHTML returns the canonical URL the page declares with
+// <link rel="canonical">, or the non-AMP version declared by an AMP page.
+// The link is resolved against the page URL and accepted only on the same
+// site, so a page cannot claim someone else's URL. Empty string is returned
+// if nothing is declared.
+func (c *Canonicalizer) CanonicalFromHTML(pageUrl string, html string) string {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return ""
+	}
+
+	href, ok := doc.Find(`link[rel~="canonical"]`).First().Attr("href")
+	if !ok {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	canonical := base.ResolveReference(ref)
+	if !sameSite(base.Hostname(), canonical.Hostname()) {
+		return ""
+	}
+	return c.Canonical(canonical.String())
+}
+
+// CanonicalFromHTML resolves the declared canonical URL with the default
+// canonicalizer.
+func CanonicalFromHTML(pageUrl string, html string) string {
+	return DefaultCanonicalizer.CanonicalFromHTML(pageUrl, html)
+}
+
+func sameSite(a string, b string) bool {
+	trim := func(host string) string {
+		host = strings.ToLower(host)
+		for _, prefix := range []string{"www.", "amp.", "m."} {
+			host = strings.TrimPrefix(host, prefix)
+		}
+		return host
+	}
+	if strings.HasSuffix(a, ".cdn.ampproject.org") {
+		return true
+	}
+	return trim(a) == trim(b)
+}
@@ -0,0 +1,109 @@
+package utils
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"https://example.com", "https://example.com/"},
+		{"http://example.com/a", "https://example.com/a"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"https://example.com:8080/a", "https://example.com:8080/a"},
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"https://example.com/a?utm_source=rss&utm_medium=feed", "https://example.com/a"},
+		{"https://example.com/a?id=5&fbclid=IwAR0", "https://example.com/a?id=5"},
+		{"https://example.com/a?gclid=1&mc_eid=2&mc_cid=3&_hsenc=4&ref=hn", "https://example.com/a"},
+		{"https://example.com/a?UTM_Campaign=x", "https://example.com/a"},
+		{"https://example.com/a?q=hello+world", "https://example.com/a?q=hello+world"},
+		{"https://example.com/news/story/amp/", "https://example.com/news/story/amp/"},
+		{"https://example.com/tags/amp", "https://example.com/tags/amp"},
+		{"https://example.com/amp/guide", "https://example.com/amp/guide"},
+		{"https://example.com/news/story/amp?amp=1", "https://example.com/news/story/"},
+		{"https://amp.example.com/news/story.amp", "https://amp.example.com/news/story"},
+		{"https://amp.example.com/amp/news/story", "https://amp.example.com/news/story"},
+		{"https://example.com/a?amp=1", "https://example.com/a"},
+		{"https://example-com.cdn.ampproject.org/c/s/example.com/news/story/amp", "https://example.com/news/story/"},
+		{"not a url", "not a url"},
+		{"/relative/path", "/relative/path"},
+	}
+
+	for _, test := range tests {
+		result := Canonical(test.url)
+		if result != test.want {
+			t.Errorf("Canonical of %s is %s, want %s", test.url, result, test.want)
+		}
+	}
+}
+
+func TestCanonicalizerRules(t *testing.T) {
+	c := NewCanonicalizer("session_*", "from")
+	c.Https = false
+	c.KeepFragment = true
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/a#top", "http://example.com/a#top"},
+		{"http://example.com/a?session_id=1&from=tg&page=2", "http://example.com/a?page=2"},
+		{"http://example.com:80/a", "http://example.com/a"},
+	}
+
+	for _, test := range tests {
+		result := c.Canonical(test.url)
+		if result != test.want {
+			t.Errorf("Canonical of %s is %s, want %s", test.url, result, test.want)
+		}
+	}
+}
+
+func TestCanonicalFromHTML(t *testing.T) {
+	tests := []struct {
+		page string
+		html string
+		want string
+	}{
+		{
+			"https://example.com/news/story/amp",
+			`<html amp><head><link rel="canonical" href="https://example.com/news/story?utm_source=amp"></head></html>`,
+			"https://example.com/news/story",
+		},
+		{
+			"https://www.example.com/a?page=1",
+			`<head><link rel="canonical" href="/a"></head>`,
+			"https://www.example.com/a",
+		},
+		{
+			"https://amp.example.com/a",
+			`<head><link rel="canonical" href="https://www.example.com/a"></head>`,
+			"https://www.example.com/a",
+		},
+		{
+			"https://example-com.cdn.ampproject.org/c/s/example.com/a",
+			`<head><link rel="canonical" href="https://example.com/a"></head>`,
+			"https://example.com/a",
+		},
+		{
+			"https://example.com/a",
+			`<head><link rel="canonical" href="https://evil.com/a"></head>`,
+			"",
+		},
+		{
+			"https://example.com/a",
+			`<head><title>No canonical</title></head>`,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		result := CanonicalFromHTML(test.page, test.html)
+		if result != test.want {
+			t.Errorf("Canonical of %s is %q, want %q", test.page, result, test.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// wrapper is a redirect link keeping the target in a query parameter.
+type wrapper struct {
+	host  string
+	path  string
+	param []string
+}
+
+// Wrappers are redirect links of aggregators and trackers unwrapped
+// without fetching them. Hosts match with subdomains.
+var wrappers = []wrapper{
+	{"google.com", "/url", []string{"url", "q"}},
+	{"facebook.com", "/l.php", []string{"u"}},
+	{"duckduckgo.com", "/l/", []string{"uddg"}},
+	{"youtube.com", "/redirect", []string{"q"}},
+	{"vk.com", "/away.php", []string{"to"}},
+	{"steamcommunity.com", "/linkfilter/", []string{"url", "u"}},
+	{"slack-redir.net", "/link", []string{"url"}},
+	{"t.umblr.com", "/redirect", []string{"z"}},
+}
+
+func matchHost(host string, want string) bool {
+	return host == want || strings.HasSuffix(host, "."+want)
+}
+
+// Unwrap returns the target of known redirect links like
+// https://www.google.com/url?q=https://example.com/ and the link itself
+// otherwise. Nested wrappers are unwrapped too.
+func Unwrap(urlStr string) string {
+	for i := 0; i < 5; i++ {
+		target, ok := unwrapOnce(urlStr)
+		if !ok {
+			break
+		}
+		urlStr = target
+	}
+	return urlStr
+}
+
+func unwrapOnce(urlStr string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(urlStr))
+	if err != nil {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, w := range wrappers {
+		if !matchHost(host, w.host) || u.Path != w.path {
+			continue
+		}
+		query := u.Query()
+		for _, param := range w.param {
+			target, err := url.Parse(query.Get(param))
+			if err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != "" {
+				return target.String(), true
+			}
+		}
+	}
+	return "", false
+}
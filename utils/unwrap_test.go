@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestUnwrap(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"https://www.google.com/url?rct=j&sa=t&url=https://example.com/a%3Fid%3D1&ct=ga&cd=CAE", "https://example.com/a?id=1"},
+		{"https://www.google.com/url?q=https%3A%2F%2Fexample.com%2Fb&sa=D", "https://example.com/b"},
+		{"https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2Fc&h=AT0", "https://example.com/c"},
+		{"https://duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com%2Fd", "https://example.com/d"},
+		{"https://vk.com/away.php?to=https%3A%2F%2Fexample.com%2Fe", "https://example.com/e"},
+		{"https://www.google.com/url?q=https%3A%2F%2Fl.facebook.com%2Fl.php%3Fu%3Dhttps%253A%252F%252Fexample.com%252Ff", "https://example.com/f"},
+		{"https://www.google.com/url?q=javascript:alert(1)", "https://www.google.com/url?q=javascript:alert(1)"},
+		{"https://www.google.com/search?q=https://example.com/", "https://www.google.com/search?q=https://example.com/"},
+		{"https://notgoogle.com/url?q=https://example.com/", "https://notgoogle.com/url?q=https://example.com/"},
+	}
+
+	for _, test := range tests {
+		result := Unwrap(test.url)
+		if result != test.want {
+			t.Errorf("Unwrap of %s is %s, want %s", test.url, result, test.want)
+		}
+	}
+}
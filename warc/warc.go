@@ -0,0 +1,161 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const Version = "WARC/1.1"
+
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+	TypeResource = "resource"
+)
+
+// Field is a single named WARC header field. Fields are kept as a slice
+// because the order of named fields is significant for some readers.
+type Field struct {
+	Name  string
+	Value string
+}
+
+type Record struct {
+	Fields []Field
+	Block  []byte
+}
+
+func (r *Record) Set(name, value string) {
+	for i, f := range r.Fields {
+		if f.Name == name {
+			r.Fields[i].Value = value
+			return
+		}
+	}
+	r.Fields = append(r.Fields, Field{Name: name, Value: value})
+}
+
+func (r *Record) Get(name string) string {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// NewRecord creates a record with the mandatory WARC-Type, WARC-Record-ID
+// and WARC-Date fields filled in.
+func NewRecord(recordType string, date time.Time, block []byte) *Record {
+	r := &Record{Block: block}
+	r.Set("WARC-Type", recordType)
+	r.Set("WARC-Record-ID", NewRecordID())
+	r.Set("WARC-Date", date.UTC().Format(time.RFC3339))
+	return r
+}
+
+func NewRecordID() string {
+	return fmt.Sprintf("<urn:uuid:%s>", uuid.NewString())
+}
+
+// Digest returns a labelled SHA-1 digest in the base32 form used by most
+// web archiving tools.
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+// NewWriter returns a writer of WARC records. When compress is set every
+// record is written as a separate gzip member, as expected of .warc.gz files.
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{
+		w:        w,
+		compress: compress,
+	}
+}
+
+func (w *Writer) WriteRecord(r *Record) error {
+	r.Set("WARC-Block-Digest", Digest(r.Block))
+	r.Set("Content-Length", strconv.Itoa(len(r.Block)))
+
+	var buf bytes.Buffer
+	buf.WriteString(Version + "\r\n")
+	for _, f := range r.Fields {
+		fmt.Fprintf(&buf, "%s: %s\r\n", f.Name, f.Value)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		_, err := w.w.Write(buf.Bytes())
+		return err
+	}
+
+	gz := gzip.NewWriter(w.w)
+	_, err := gz.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WriteWarcinfo writes the warcinfo record describing the file and returns
+// its record ID so other records can refer to it.
+func (w *Writer) WriteWarcinfo(filename string, fields []Field) (string, error) {
+	var block bytes.Buffer
+	for _, f := range fields {
+		fmt.Fprintf(&block, "%s: %s\r\n", f.Name, f.Value)
+	}
+
+	r := NewRecord(TypeWarcinfo, time.Now(), block.Bytes())
+	r.Set("WARC-Filename", filename)
+	r.Set("Content-Type", "application/warc-fields")
+	err := w.WriteRecord(r)
+	if err != nil {
+		return "", err
+	}
+	return r.Get("WARC-Record-ID"), nil
+}
+
+// HTTPRequest renders a request message as it would have been sent on the wire.
+func HTTPRequest(method string, u *url.URL, header http.Header) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", method, u.RequestURI())
+	fmt.Fprintf(&buf, "Host: %s\r\n", u.Host)
+	header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// HTTPResponse renders a response message. Transfer and content encodings
+// are dropped from the header because the stored body is already decoded.
+func HTTPResponse(status int, header http.Header, body []byte) []byte {
+	h := header.Clone()
+	h.Del("Content-Encoding")
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
@@ -0,0 +1,80 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteRecord(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, false)
+
+	date := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRecord(TypeResource, date, []byte("<p>hello</p>"))
+	r.Set("WARC-Target-URI", "https://example.com/")
+	err := w.WriteRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "WARC/1.1\r\nWARC-Type: resource\r\n") {
+		t.Errorf("Record starts with wrong header: %q", out)
+	}
+	if !strings.Contains(out, "WARC-Date: 2023-05-01T10:00:00Z\r\n") {
+		t.Errorf("Record has no WARC-Date: %q", out)
+	}
+	if !strings.Contains(out, "Content-Length: 12\r\n") {
+		t.Errorf("Record has wrong Content-Length: %q", out)
+	}
+	if !strings.HasSuffix(out, "\r\n\r\n<p>hello</p>\r\n\r\n") {
+		t.Errorf("Record block is not terminated: %q", out)
+	}
+}
+
+func TestWriteCompressedRecords(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, true)
+
+	for i := 0; i < 2; i++ {
+		err := w.WriteRecord(NewRecord(TypeResource, time.Now(), []byte("x")))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "WARC/1.1\r\n"); n != 2 {
+		t.Errorf("Expected 2 records, got %d", n)
+	}
+}
+
+func TestHTTPResponse(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	header.Set("Content-Encoding", "gzip")
+	header.Set("Content-Length", "999")
+
+	out := string(HTTPResponse(200, header, []byte("body")))
+	if !strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n") {
+		t.Errorf("Wrong status line: %q", out)
+	}
+	if strings.Contains(out, "Content-Encoding") {
+		t.Errorf("Content-Encoding is not dropped: %q", out)
+	}
+	if !strings.Contains(out, "Content-Length: 4\r\n") {
+		t.Errorf("Content-Length is not fixed: %q", out)
+	}
+}
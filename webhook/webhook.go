@@ -0,0 +1,257 @@
+// Package webhook posts events to webhooks of users' services.
+//
+// Events are posted as JSON with headers telling the event type, the
+// delivery id and the HMAC-SHA256 signature of the body made with the
+// secret of the webhook, signed like content pushed by WebSub hubs. Events wait in the outbox of the store until they
+// are delivered, failed deliveries are retried with exponential backoff.
+// Every attempt is written to the delivery log.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmshv/feeder/events"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/websub"
+)
+
+const (
+	EventHeader     = "X-Feeder-Event"
+	DeliveryHeader  = "X-Feeder-Delivery"
+	SignatureHeader = "X-Feeder-Signature"
+
+	// MaxAttempts is the number of attempts to deliver an event.
+	MaxAttempts = 5
+	// batchSize is the number of events of the outbox attempted at once.
+	batchSize = 100
+)
+
+// Store keeps webhooks, the outbox of events to deliver and the delivery
+// log.
+type Store interface {
+	GetWebhooks() ([]internal.Webhook, error)
+	AddWebhookEvents([]internal.WebhookEvent) error
+	GetDueWebhookEvents(time.Time, int) ([]internal.WebhookEvent, error)
+	UpdateWebhookEvent(internal.WebhookEvent) error
+	DeleteWebhookEvent(int64) error
+	AddWebhookDelivery(internal.WebhookDelivery) error
+	DeleteWebhookDeliveries(time.Time) (int64, error)
+}
+
+// Match tells if the webhook wants the event.
+func Match(hook internal.Webhook, e events.Event) bool {
+	filter := events.Filter{
+		Types: hook.Events,
+		Feeds: hook.Feeds,
+		Tags:  hook.Tags,
+	}
+	return filter.Match(e)
+}
+
+type Dispatcher struct {
+	db     Store
+	client *http.Client
+	// Backoff is the delay before the second attempt. It doubles with
+	// every next attempt.
+	Backoff time.Duration
+	// Interval is how often the outbox is checked for events to retry.
+	Interval time.Duration
+	// Retention is how long attempts are kept in the delivery log.
+	Retention time.Duration
+	wake      chan struct{}
+}
+
+func NewDispatcher(db Store) *Dispatcher {
+	return &Dispatcher{
+		db:        db,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		Backoff:   10 * time.Second,
+		Interval:  5 * time.Second,
+		Retention: 7 * 24 * time.Hour,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Enqueue puts the event to the outbox of every matching webhook. It is
+// meant to be a hook of the bus, so no event is missed. Webhooks are read
+// on every event, so webhooks added while feeder runs get events too.
+func (d *Dispatcher) Enqueue(e events.Event) {
+	hooks, err := d.db.GetWebhooks()
+	if err != nil {
+		log.Printf("Failed to get webhooks: %v", err)
+		return
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode event %d: %v", e.ID, err)
+		return
+	}
+
+	var list []internal.WebhookEvent
+	for _, hook := range hooks {
+		if Match(hook, e) {
+			list = append(list, internal.WebhookEvent{
+				WebhookID:  hook.ID,
+				DeliveryID: uuid.NewString(),
+				EventType:  e.Type,
+				Payload:    string(body),
+			})
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+	err = d.db.AddWebhookEvents(list)
+	if err != nil {
+		log.Printf("Failed to add %s to the webhook outbox: %v", e.Type, err)
+		return
+	}
+	d.notify()
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers events of the outbox as they are enqueued and retries
+// failed ones when they are due. Events left by the previous run are
+// delivered first. Attempts older than Retention are deleted from the
+// delivery log every hour.
+func (d *Dispatcher) Run() {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+	d.cleanup()
+	for {
+		d.deliverDue()
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		case <-cleanup.C:
+			d.cleanup()
+		}
+	}
+}
+
+func (d *Dispatcher) cleanup() {
+	n, err := d.db.DeleteWebhookDeliveries(time.Now().Add(-d.Retention))
+	if err != nil {
+		log.Printf("Failed to delete old webhook deliveries: %v", err)
+	}
+	if n > 0 {
+		log.Printf("Deleted %d old webhook deliveries", n)
+	}
+}
+
+// deliverDue attempts events of the outbox due by now. Webhooks get their
+// events in parallel, each one in the order they were enqueued.
+func (d *Dispatcher) deliverDue() {
+	list, err := d.db.GetDueWebhookEvents(time.Now(), batchSize)
+	if err != nil {
+		log.Printf("Failed to get webhook events: %v", err)
+		return
+	}
+	if len(list) == 0 {
+		return
+	}
+	if len(list) == batchSize {
+		d.notify()
+	}
+	hooks, err := d.db.GetWebhooks()
+	if err != nil {
+		log.Printf("Failed to get webhooks: %v", err)
+		return
+	}
+
+	byHook := map[string][]internal.WebhookEvent{}
+	for _, e := range list {
+		byHook[e.WebhookID] = append(byHook[e.WebhookID], e)
+	}
+	var wg sync.WaitGroup
+	for _, hook := range hooks {
+		pending := byHook[hook.ID]
+		if len(pending) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(hook internal.Webhook, pending []internal.WebhookEvent) {
+			defer wg.Done()
+			for _, e := range pending {
+				d.attempt(hook, e)
+			}
+		}(hook, pending)
+	}
+	wg.Wait()
+}
+
+// attempt posts the event once and returns the status. Delivered events
+// and events out of attempts leave the outbox, others wait for the next
+// attempt.
+func (d *Dispatcher) attempt(hook internal.Webhook, e internal.WebhookEvent) int {
+	e.Attempts += 1
+	status, err := d.post(hook, e.DeliveryID, e.EventType, []byte(e.Payload))
+	delivery := internal.WebhookDelivery{
+		WebhookID:  hook.ID,
+		DeliveryID: e.DeliveryID,
+		EventType:  e.EventType,
+		Attempt:    e.Attempts,
+		Status:     status,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if logErr := d.db.AddWebhookDelivery(delivery); logErr != nil {
+		log.Printf("Failed to log delivery to %s: %v", hook.Url, logErr)
+	}
+
+	if err != nil && e.Attempts < MaxAttempts {
+		e.NextAttemptAt = time.Now().Add(d.Backoff << (e.Attempts - 1))
+		if err := d.db.UpdateWebhookEvent(e); err != nil {
+			log.Printf("Failed to update webhook event %d: %v", e.ID, err)
+		}
+		return status
+	}
+	if err != nil {
+		log.Printf("Failed to deliver %s to %s: %v", e.EventType, hook.Url, err)
+	}
+	if err := d.db.DeleteWebhookEvent(e.ID); err != nil {
+		log.Printf("Failed to delete webhook event %d: %v", e.ID, err)
+	}
+	return status
+}
+
+func (d *Dispatcher) post(hook internal.Webhook, deliveryID string, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "feeder-webhook/0.1")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, websub.Sign(hook.Secret, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
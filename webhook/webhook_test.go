@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmshv/feeder/events"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/websub"
+)
+
+type memStore struct {
+	mu         sync.Mutex
+	hooks      []internal.Webhook
+	outbox     []internal.WebhookEvent
+	lastID     int64
+	deliveries []internal.WebhookDelivery
+}
+
+func (m *memStore) GetWebhooks() ([]internal.Webhook, error) {
+	return m.hooks, nil
+}
+
+func (m *memStore) AddWebhookEvents(list []internal.WebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range list {
+		m.lastID += 1
+		e.ID = m.lastID
+		m.outbox = append(m.outbox, e)
+	}
+	return nil
+}
+
+func (m *memStore) GetDueWebhookEvents(now time.Time, limit int) ([]internal.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []internal.WebhookEvent
+	for _, e := range m.outbox {
+		if !e.NextAttemptAt.After(now) && len(list) < limit {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+func (m *memStore) UpdateWebhookEvent(e internal.WebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outbox {
+		if m.outbox[i].ID == e.ID {
+			m.outbox[i] = e
+		}
+	}
+	return nil
+}
+
+func (m *memStore) DeleteWebhookEvent(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outbox {
+		if m.outbox[i].ID == id {
+			m.outbox = append(m.outbox[:i], m.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memStore) AddWebhookDelivery(d internal.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, d)
+	return nil
+}
+
+func (m *memStore) DeleteWebhookDeliveries(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// drain attempts events of the outbox until it is empty.
+func drain(t *testing.T, d *Dispatcher, db *memStore) {
+	for i := 0; i < 2*MaxAttempts; i++ {
+		d.deliverDue()
+		if len(db.outbox) == 0 {
+			return
+		}
+	}
+	t.Fatalf("Outbox keeps %d events", len(db.outbox))
+}
+
+func TestMatch(t *testing.T) {
+	e := events.Event{Type: events.RecordCreated, Feed: "news", Tags: []string{"go"}}
+	tests := []struct {
+		name string
+		hook internal.Webhook
+		want bool
+	}{
+		{"any", internal.Webhook{}, true},
+		{"event", internal.Webhook{Events: []string{events.RecordCreated}}, true},
+		{"other event", internal.Webhook{Events: []string{events.FeedFailed}}, false},
+		{"feed and tag", internal.Webhook{Feeds: []string{"news"}, Tags: []string{"go"}}, true},
+		{"other tag", internal.Webhook{Tags: []string{"rust"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.hook, e); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls += 1
+		body, _ := io.ReadAll(r.Body)
+		if !websub.VerifySignature("secret", r.Header.Get(SignatureHeader), body) {
+			t.Errorf("Bad signature %s", r.Header.Get(SignatureHeader))
+		}
+		if r.Header.Get(EventHeader) != events.RecordCreated {
+			t.Errorf("Bad event header %s", r.Header.Get(EventHeader))
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	hook := internal.Webhook{ID: "h1", Url: srv.URL, Secret: "secret"}
+	other := internal.Webhook{ID: "h2", Url: srv.URL, Events: []string{events.FeedFailed}}
+	db := &memStore{hooks: []internal.Webhook{hook, other}}
+	d := NewDispatcher(db)
+	d.Backoff = 0
+	d.Enqueue(events.Event{ID: 1, Type: events.RecordCreated})
+	drain(t, d, db)
+
+	if len(db.deliveries) != 3 {
+		t.Fatalf("Logged %d attempts, want 3", len(db.deliveries))
+	}
+	first, last := db.deliveries[0], db.deliveries[2]
+	if first.Status != http.StatusBadGateway || first.Error == "" {
+		t.Errorf("First attempt logged as %d %q", first.Status, first.Error)
+	}
+	if last.Attempt != 3 || last.Status != http.StatusOK || last.Error != "" || last.DeliveryID != first.DeliveryID {
+		t.Errorf("Last attempt logged as %+v", last)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	db := &memStore{hooks: []internal.Webhook{{ID: "h1", Url: srv.URL}}}
+	d := NewDispatcher(db)
+	d.Backoff = 0
+	d.Enqueue(events.Event{ID: 1, Type: events.FeedFailed})
+	drain(t, d, db)
+	if len(db.deliveries) != MaxAttempts {
+		t.Errorf("Logged %d attempts, want %d", len(db.deliveries), MaxAttempts)
+	}
+}
+
+func TestDeliverWaitsForRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	db := &memStore{hooks: []internal.Webhook{{ID: "h1", Url: srv.URL}}}
+	d := NewDispatcher(db)
+	d.Backoff = time.Hour
+	d.Enqueue(events.Event{ID: 1, Type: events.RecordCreated})
+	d.deliverDue()
+	d.deliverDue()
+	if len(db.deliveries) != 1 {
+		t.Errorf("Logged %d attempts, want 1", len(db.deliveries))
+	}
+	if len(db.outbox) != 1 || db.outbox[0].Attempts != 1 || db.outbox[0].NextAttemptAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("Outbox keeps %+v", db.outbox)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/events"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+)
+
+type WebhookFlags struct {
+	Secret string   `help:"Secret signing deliveries. A random one is made and printed if empty."`
+	Feed   []string `help:"Deliver events of the feeds with these slugs only."`
+	Tag    []string `help:"Deliver events of records with these tags only."`
+	Event  []string `help:"Deliver these events only: record.created, page.extracted, feed.failed."`
+}
+
+func addWebhook(db store.Store, hookUrl string, flags WebhookFlags) error {
+	u, err := url.Parse(hookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook url must be an absolute http or https URL")
+	}
+	for _, e := range flags.Event {
+		if !events.Known(e) {
+			return fmt.Errorf("unknown event %s, use one of %s", e, strings.Join(events.Types, ", "))
+		}
+	}
+	for _, slug := range flags.Feed {
+		_, err := db.GetFeedBySlug(slug)
+		if err != nil {
+			return fmt.Errorf("feed %s not found", slug)
+		}
+	}
+
+	secret := flags.Secret
+	if secret == "" {
+		secret, _, err = auth.NewToken()
+		if err != nil {
+			return err
+		}
+	}
+	hook, err := db.AddWebhook(internal.Webhook{
+		Url:    hookUrl,
+		Secret: secret,
+		Feeds:  flags.Feed,
+		Tags:   flags.Tag,
+		Events: flags.Event,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hook.ID)
+	if flags.Secret == "" {
+		fmt.Printf("Secret: %s\n", secret)
+	}
+	return nil
+}
+
+func listWebhooks(db store.Store) error {
+	hooks, err := db.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		fmt.Printf("%s\t%s\tevents=%s\tfeeds=%s\ttags=%s\n", hook.ID, hook.Url, listOrAny(hook.Events), listOrAny(hook.Feeds), listOrAny(hook.Tags))
+	}
+	return nil
+}
+
+// listWebhookDeliveries prints recent delivery attempts of the webhook.
+func listWebhookDeliveries(db store.Store, id string, limit int) error {
+	deliveries, err := db.GetWebhookDeliveries(id, limit)
+	if err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		result := fmt.Sprintf("%d", d.Status)
+		if d.Error != "" {
+			result = d.Error
+		}
+		fmt.Printf("%s\t%s\t%s\t#%d\t%s\n", d.CreatedAt.Format("2006-01-02 15:04:05"), d.DeliveryID, d.EventType, d.Attempt, result)
+	}
+	return nil
+}
+
+func listOrAny(list []string) string {
+	if len(list) == 0 {
+		return "*"
+	}
+	return strings.Join(list, ",")
+}
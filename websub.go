@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tmshv/feeder/auth"
+	"github.com/tmshv/feeder/internal"
+	"github.com/tmshv/feeder/store"
+	"github.com/tmshv/feeder/websub"
+)
+
+const (
+	// websubLease is the lease asked from hubs. Hubs may give another.
+	websubLease = 7 * 24 * time.Hour
+	// websubPoll is the refresh period of feeds pushed by hubs, in case
+	// pushes stop coming.
+	websubPoll = 6 * time.Hour
+	// websubRetry is the time to wait for a hub to verify a subscription
+	// before asking again. Failed subscriptions are retried as often.
+	websubRetry = time.Hour
+)
+
+var websubClient = &http.Client{Timeout: 30 * time.Second}
+
+func websubCallback(feed internal.Feed) string {
+	return fmt.Sprintf("%s/websub/callback/%s", baseUrl, feed.ID)
+}
+
+// syncWebSub keeps the feed subscribed to the hub it advertises and
+// renews the lease before it expires. It returns the time to wait before
+// fetching the feed again: the refresh period of the feed until the hub
+// pushes updates, and websubPoll or more after that. Feeds of hubs not
+// verifying subscriptions are polled as usual, as are all feeds unless
+// websubEnabled. Requests are saved before they are sent, so the callback
+// confirms them when hubs verify at once.
+func syncWebSub(db store.Store, feed internal.Feed, links websub.Links, wait time.Duration) time.Duration {
+	if !websubEnabled {
+		return wait
+	}
+	sub, err := db.GetWebSubSubscription(feed.ID)
+	found := err == nil
+	topic := links.Self
+	if topic == "" {
+		topic = feed.Url
+	}
+	same := found && sub.Hub == links.Hub && sub.Topic == topic
+
+	if found && !same {
+		// The feed moved to another hub or stopped using it. The old
+		// subscription is kept until the hub verifies the unsubscription
+		// or gives up on it.
+		if sub.Requested == "unsubscribe" && time.Since(sub.UpdatedAt) < websubRetry {
+			return wait
+		}
+		if sub.Requested != "unsubscribe" {
+			sub.Requested = "unsubscribe"
+			err = db.SaveWebSubSubscription(sub)
+			if err == nil {
+				err = websub.Unsubscribe(context.Background(), websubClient, websub.Request{
+					Hub:      sub.Hub,
+					Topic:    sub.Topic,
+					Callback: websubCallback(feed),
+				})
+			}
+			if err == nil {
+				log.Printf("Unsubscribing feed %s from %s", feed.Slug, sub.Hub)
+				return wait
+			}
+			log.Printf("Failed to unsubscribe feed %s from %s: %v", feed.Slug, sub.Hub, err)
+		}
+		err = db.DeleteWebSubSubscription(feed.ID)
+		if err != nil {
+			log.Printf("Failed to delete WebSub subscription of %s: %v", feed.Slug, err)
+		}
+	}
+	if links.Hub == "" {
+		return wait
+	}
+
+	renewAt := sub.ExpiresAt.Add(-time.Duration(sub.Lease) * time.Second / 10)
+	switch {
+	case same && sub.Active() && time.Now().Before(renewAt):
+		return pushedWait(wait, time.Until(renewAt))
+	case same && time.Since(sub.UpdatedAt) < websubRetry:
+		// The hub has not verified the last request yet.
+		if sub.Active() {
+			return pushedWait(wait, websubRetry)
+		}
+		return wait
+	}
+
+	if !same {
+		secret, _, err := auth.NewToken()
+		if err != nil {
+			log.Printf("Failed to make WebSub secret of %s: %v", feed.Slug, err)
+			return wait
+		}
+		sub = internal.WebSubSubscription{
+			FeedID: feed.ID,
+			Hub:    links.Hub,
+			Topic:  topic,
+			Secret: secret,
+			State:  internal.WebSubPending,
+		}
+	}
+
+	sub.Requested = "subscribe"
+	sub.Error = ""
+	if !sub.Active() {
+		sub.State = internal.WebSubPending
+	}
+	err = db.SaveWebSubSubscription(sub)
+	if err != nil {
+		log.Printf("Failed to save WebSub subscription of %s: %v", feed.Slug, err)
+		return wait
+	}
+	err = websub.Subscribe(context.Background(), websubClient, websub.Request{
+		Hub:      sub.Hub,
+		Topic:    sub.Topic,
+		Callback: websubCallback(feed),
+		Secret:   sub.Secret,
+		Lease:    websubLease,
+	})
+	if err != nil {
+		log.Printf("Failed to subscribe feed %s to %s: %v", feed.Slug, sub.Hub, err)
+		sub.Requested = ""
+		sub.Error = err.Error()
+		if !sub.Active() {
+			sub.State = internal.WebSubFailed
+		}
+		err = db.SaveWebSubSubscription(sub)
+		if err != nil {
+			log.Printf("Failed to save WebSub subscription of %s: %v", feed.Slug, err)
+		}
+	} else {
+		log.Printf("Subscribed feed %s to %s", feed.Slug, sub.Hub)
+	}
+
+	if sub.Active() {
+		return pushedWait(wait, websubRetry)
+	}
+	return wait
+}
+
+// pushedWait is the time to wait before fetching a pushed feed: websubPoll
+// or the refresh period if it is longer, but no longer than until.
+func pushedWait(wait time.Duration, until time.Duration) time.Duration {
+	if wait < websubPoll {
+		wait = websubPoll
+	}
+	if until < wait {
+		wait = until
+	}
+	return wait
+}
@@ -0,0 +1,161 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MaxLease limits leases subscribers of the hub ask for.
+const MaxLease = 30 * 24 * time.Hour
+
+// ErrGone is returned by Publish when the subscriber answers 410 and does
+// not want the topic anymore.
+var ErrGone = errors.New("subscriber is gone")
+
+// ErrPrivateAddress is returned for callbacks on loopback, private or
+// link-local addresses. The hub does not request the network it runs in
+// for anyone asking.
+var ErrPrivateAddress = errors.New("callback address is not public")
+
+// IsPublic tells if the hub may request the address.
+func IsPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// CheckCallback tells if the callback is an http(s) URL on a host
+// resolving to public addresses only.
+func CheckCallback(ctx context.Context, callback *url.URL) error {
+	if !callback.IsAbs() || (callback.Scheme != "http" && callback.Scheme != "https") || callback.Hostname() == "" {
+		return errors.New("callback is not an absolute http(s) URL")
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", callback.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !IsPublic(ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// NewPublicClient makes a client connecting to public addresses only.
+// Addresses are checked when connecting, so names resolving differently
+// after CheckCallback and redirects are refused too.
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !IsPublic(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the callback.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// Sign makes the signature header of content pushed to subscribers with
+// the secret, like sha256=<hex hmac of the body>. Webhooks are signed with
+// it too.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyIntent asks the callback to confirm the subscription request of
+// the mode, subscribe or unsubscribe, by echoing a random challenge.
+func VerifyIntent(ctx context.Context, client *http.Client, mode string, req Request) error {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return err
+	}
+	challenge := hex.EncodeToString(buf)
+
+	u, err := url.Parse(req.Callback)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("hub.mode", mode)
+	query.Set("hub.topic", req.Topic)
+	query.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(int(req.Lease.Seconds())))
+	}
+	u.RawQuery = query.Encode()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("callback answered %d", res.StatusCode)
+	}
+	if strings.TrimSpace(string(body)) != challenge {
+		return errors.New("callback did not echo the challenge")
+	}
+	return nil
+}
+
+// Publish pushes content of the topic to the subscriber. The content is
+// signed if the subscription has a secret.
+func Publish(ctx context.Context, client *http.Client, req Request, contentType string, body []byte) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, req.Callback, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("Link", fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, req.Hub, req.Topic))
+	if req.Secret != "" {
+		r.Header.Set(SignatureHeader, Sign(req.Secret, body))
+	}
+	res, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode == http.StatusGone {
+		return ErrGone
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("subscriber answered %d", res.StatusCode)
+	}
+	return nil
+}
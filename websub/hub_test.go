@@ -0,0 +1,174 @@
+package websub
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	got := Sign("secret", body)
+	if got != "sha256=03def589620c813f198fd03d7967e292b163ef0435ebf43071ce0e9519763cb7" {
+		t.Errorf("Sign() = %s", got)
+	}
+	if !VerifySignature("secret", got, body) {
+		t.Errorf("Signature %s is not verified", got)
+	}
+}
+
+func TestVerifyIntent(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr bool
+	}{
+		{"echo", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.URL.Query().Get("hub.challenge"))
+		}, false},
+		{"wrong challenge", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "nope")
+		}, true},
+		{"not found", func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query map[string][]string
+			callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				tt.handler(w, r)
+			}))
+			defer callback.Close()
+
+			err := VerifyIntent(context.Background(), callback.Client(), "subscribe", Request{
+				Topic:    "http://127.0.0.1:3000/feed/test",
+				Callback: callback.URL + "/cb?id=1",
+				Lease:    time.Hour,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyIntent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := map[string]string{
+				"id":                "1",
+				"hub.mode":          "subscribe",
+				"hub.topic":         "http://127.0.0.1:3000/feed/test",
+				"hub.lease_seconds": "3600",
+			}
+			for key, value := range want {
+				if v := query[key]; len(v) != 1 || v[0] != value {
+					t.Errorf("%s = %v, want %s", key, v, value)
+				}
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	var got http.Header
+	var body []byte
+	status := http.StatusOK
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer callback.Close()
+
+	req := Request{
+		Hub:      "http://127.0.0.1:3000/websub/hub",
+		Topic:    "http://127.0.0.1:3000/feed/test",
+		Callback: callback.URL,
+		Secret:   "secret",
+	}
+	err := Publish(context.Background(), callback.Client(), req, "application/json", []byte(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"id":1}` || got.Get("Content-Type") != "application/json" {
+		t.Errorf("Wrong content %s of %s", body, got.Get("Content-Type"))
+	}
+	if links := Discover(&url.URL{}, got, nil); links.Hub != req.Hub || links.Self != req.Topic {
+		t.Errorf("Wrong links %v", links)
+	}
+	if !VerifySignature("secret", got.Get(SignatureHeader), body) {
+		t.Errorf("Wrong signature %s", got.Get(SignatureHeader))
+	}
+
+	status = http.StatusGone
+	err = Publish(context.Background(), callback.Client(), req, "application/json", []byte(`{}`))
+	if !errors.Is(err, ErrGone) {
+		t.Errorf("Publish() error = %v, want ErrGone", err)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IsPublic(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsPublic(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCallback(t *testing.T) {
+	tests := []struct {
+		callback string
+		wantErr  bool
+	}{
+		{"http://93.184.216.34/cb", false},
+		{"http://127.0.0.1:8080/cb", true},
+		{"http://localhost/cb", true},
+		{"https://[::1]/cb", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"ftp://93.184.216.34/cb", true},
+		{"/cb", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callback, func(t *testing.T) {
+			u, err := url.Parse(tt.callback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckCallback(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCallback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPublicClient(t *testing.T) {
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer callback.Close()
+
+	_, err := NewPublicClient(time.Second).Get(callback.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Get() error = %v, want ErrPrivateAddress", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Package websub subscribes to WebSub (PubSubHubbub) hubs pushing updates
+// of feeds, so feeds need not be polled often. It also has the parts of a
+// hub pushing feeds of feeder to their subscribers.
+//
+// See https://www.w3.org/TR/websub/
+package websub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the signature of pushed content.
+	SignatureHeader = "X-Hub-Signature"
+)
+
+// Links are the hub a feed is published to and the topic URL the feed is
+// known to the hub by.
+type Links struct {
+	Hub  string
+	Self string
+}
+
+// Discover finds hub and self links in Link headers of the response and
+// in link elements of the feed, <link rel="hub"> of Atom and
+// <atom:link rel="hub"> of RSS. Headers take precedence. Relative links
+// are resolved against base, the URL the feed was fetched from.
+func Discover(base *url.URL, header http.Header, body []byte) Links {
+	var links Links
+	for _, value := range header.Values("Link") {
+		for _, part := range strings.Split(value, ",") {
+			target, rels, ok := parseLinkHeader(part)
+			if !ok {
+				continue
+			}
+			for _, rel := range rels {
+				if rel == "hub" && links.Hub == "" {
+					links.Hub = target
+				}
+				if rel == "self" && links.Self == "" {
+					links.Self = target
+				}
+			}
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	for links.Hub == "" || links.Self == "" {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		el, ok := token.(xml.StartElement)
+		if !ok || el.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = attr.Value
+			case "href":
+				href = attr.Value
+			}
+		}
+		if href == "" {
+			continue
+		}
+		for _, r := range strings.Fields(rel) {
+			if r == "hub" && links.Hub == "" {
+				links.Hub = href
+			}
+			if r == "self" && links.Self == "" {
+				links.Self = href
+			}
+		}
+	}
+	links.Hub = resolve(base, links.Hub)
+	links.Self = resolve(base, links.Self)
+	return links
+}
+
+// resolve makes the link absolute. Links that are not URLs are dropped.
+func resolve(base *url.URL, href string) string {
+	if href == "" {
+		return ""
+	}
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// parseLinkHeader reads a link of the Link header like
+// <https://hub.example/>; rel="hub".
+func parseLinkHeader(value string) (string, []string, bool) {
+	parts := strings.Split(value, ";")
+	target := strings.TrimSpace(parts[0])
+	if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+		return "", nil, false
+	}
+	target = target[1 : len(target)-1]
+	for _, param := range parts[1:] {
+		key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(key, "rel") {
+			continue
+		}
+		return target, strings.Fields(strings.Trim(val, `"`)), true
+	}
+	return "", nil, false
+}
+
+// VerifySignature checks the signature header of pushed content, like
+// sha256=<hex hmac of the body>. Hubs may use sha1, sha256, sha384 or
+// sha512.
+func VerifySignature(secret string, signature string, body []byte) bool {
+	method, sum, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
+	}
+	var h func() hash.Hash
+	switch method {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+	want, err := hex.DecodeString(sum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// Request is a subscription request sent to a hub.
+type Request struct {
+	Hub      string
+	Topic    string
+	Callback string
+	Secret   string
+	Lease    time.Duration
+}
+
+// Subscribe asks the hub to push the topic to the callback. The hub
+// verifies the intent with a request to the callback later.
+func Subscribe(ctx context.Context, client *http.Client, req Request) error {
+	return send(ctx, client, "subscribe", req)
+}
+
+// Unsubscribe asks the hub to stop pushing the topic to the callback.
+func Unsubscribe(ctx context.Context, client *http.Client, req Request) error {
+	return send(ctx, client, "unsubscribe", req)
+}
+
+func send(ctx context.Context, client *http.Client, mode string, req Request) error {
+	form := url.Values{
+		"hub.mode":     {mode},
+		"hub.topic":    {req.Topic},
+		"hub.callback": {req.Callback},
+	}
+	if req.Secret != "" {
+		form.Set("hub.secret", req.Secret)
+	}
+	if req.Lease > 0 {
+		form.Set("hub.lease_seconds", strconv.Itoa(int(req.Lease.Seconds())))
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, req.Hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("hub answered %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package websub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   Links
+	}{
+		{
+			name: "atom",
+			body: `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom">
+				<link rel="alternate" href="https://example.com/"/>
+				<link rel="hub" href="https://hub.example.com/"/>
+				<link rel="self" href="https://example.com/feed.atom"/></feed>`,
+			want: Links{Hub: "https://hub.example.com/", Self: "https://example.com/feed.atom"},
+		},
+		{
+			name: "rss",
+			body: `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+				<link>https://example.com/</link>
+				<atom:link href="https://example.com/rss" rel="self" type="application/rss+xml"/>
+				<atom:link href="https://pubsubhubbub.appspot.com/" rel="hub"/></channel></rss>`,
+			want: Links{Hub: "https://pubsubhubbub.appspot.com/", Self: "https://example.com/rss"},
+		},
+		{
+			name: "header",
+			header: http.Header{"Link": {
+				`<https://hub.example.com/>; rel="hub", <https://example.com/feed>; rel="self"`,
+			}},
+			body: `<feed><link rel="hub" href="https://other.example.com/"/></feed>`,
+			want: Links{Hub: "https://hub.example.com/", Self: "https://example.com/feed"},
+		},
+		{
+			name: "relative",
+			header: http.Header{"Link": {
+				`</hub>; rel="hub"`,
+			}},
+			body: `<feed><link rel="self" href="feed.atom"/></feed>`,
+			want: Links{Hub: "https://example.com/hub", Self: "https://example.com/blog/feed.atom"},
+		},
+		{
+			name: "none",
+			body: `<rss><channel><link>https://example.com/</link></channel></rss>`,
+			want: Links{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, _ := url.Parse("https://example.com/blog/rss")
+			if got := Discover(base, tt.header, []byte(tt.body)); got != tt.want {
+				t.Errorf("Discover() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	// echo -n '{"id":1}' | openssl dgst -sha1 -hmac secret
+	sha1 := "sha1=a64abd01291976b35debd870ad13a30c94343831"
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		want      bool
+	}{
+		{"sha256", "secret", "sha256=03def589620c813f198fd03d7967e292b163ef0435ebf43071ce0e9519763cb7", true},
+		{"sha1", "secret", sha1, true},
+		{"wrong secret", "other", sha1, false},
+		{"unknown method", "secret", "md5=46ac5e2b", false},
+		{"no method", "secret", "46ac5e2b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySignature(tt.secret, tt.signature, body); got != tt.want {
+				t.Errorf("VerifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	var got http.Header
+	var form map[string][]string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	err := Subscribe(context.Background(), hub.Client(), Request{
+		Hub:      hub.URL,
+		Topic:    "https://example.com/feed",
+		Callback: "https://feeder.example.com/websub/callback/1",
+		Secret:   "secret",
+		Lease:    24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type %s", got.Get("Content-Type"))
+	}
+	want := map[string]string{
+		"hub.mode":          "subscribe",
+		"hub.topic":         "https://example.com/feed",
+		"hub.callback":      "https://feeder.example.com/websub/callback/1",
+		"hub.secret":        "secret",
+		"hub.lease_seconds": "86400",
+	}
+	for key, value := range want {
+		if v := form[key]; len(v) != 1 || v[0] != value {
+			t.Errorf("%s = %v, want %s", key, v, value)
+		}
+	}
+}
+
+func TestSubscribeRejected(t *testing.T) {
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "topic not found", http.StatusBadRequest)
+	}))
+	defer hub.Close()
+
+	err := Subscribe(context.Background(), hub.Client(), Request{Hub: hub.URL, Topic: "t", Callback: "c"})
+	if err == nil {
+		t.Errorf("Rejected subscription gives no error")
+	}
+}